@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/gpio"
+)
+
+// buttonActions are the actions the buttons can be mapped to, see config.ButtonActions
+func (a *app) buttonActions() map[string]func() {
+	return map[string]func(){
+		"direction": a.toggleDirection,
+		"undo":      a.undoLastScan,
+		"wifi": func() {
+			a.push(a.wifiPrintView())
+		},
+		"menu": func() {
+			a.push(a.mainMenuView())
+		},
+		"home": a.home,
+	}
+}
+
+// setupButtons checks the mapping of the buttons, the presses are read by readButtons
+func (a *app) setupButtons() {
+	actions := a.buttonActions()
+	for press, action := range a.cfg.ButtonActions {
+		if _, ok := actions[action]; !ok {
+			logger.Criticalf("unknown action of button %v: %v", press, action)
+			os.Exit(1)
+		}
+	}
+}
+
+// readButtons sends the presses of the buttons as keypresses, so they count as activity
+func (a *app) readButtons(keys chan<- keypress) {
+	opts := a.hw.GPIOOpts(a.cfg)
+	if len(opts.Buttons) == 0 {
+		return
+	}
+
+	presses := make(chan gpio.Press)
+	if err := gpio.WatchButtons(a.ctx, &opts, presses); err != nil {
+		logger.Criticalf("buttons disabled: %v", err)
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case <-a.ctx.Done():
+				return
+			case p := <-presses:
+				logger.Tracef("button pressed: %v", p)
+				select {
+				case <-a.ctx.Done():
+					return
+				case keys <- keypress{button: p.String(), at: time.Now()}:
+				}
+			}
+		}
+	}()
+}
+
+// handleButton runs the action of the press, <button> or <button>:long
+func (a *app) handleButton(press string) {
+	if a.shuttingDown {
+		return
+	}
+
+	action, ok := a.cfg.ButtonActions[press]
+	if !ok {
+		logger.Debugf("no action for button press: %v", press)
+		return
+	}
+
+	logger.Debugf("button %v: %v", press, action)
+	a.buttonActions()[action]()
+}
+
+// toggleDirection switches between EGRESS and INGRESS, keeping the currier
+func (a *app) toggleDirection() {
+	if a.dir == EGRESS {
+		a.dir = INGRESS
+	} else {
+		a.dir = EGRESS
+	}
+	a.persistSettings()
+	logger.Debugf("direction toggled: %v-%v", a.dir.String(), a.currier)
+
+	a.home()
+	a.writeBarcodeTitle()
+	a.successFeedback()
+}
+
+// undoLastScan stores a row cancelling the last stored barcode, the rows are never deleted,
+// only the last one can be undone and only once
+func (a *app) undoLastScan() {
+	a.home()
+	if a.lastStored == nil {
+		a.screen.WriteLine(2, "Nothing to undo")
+		a.failFeedback()
+		return
+	}
+
+	b := *a.lastStored
+	a.lastStored = nil
+	for _, src := range a.sources {
+		if src.id == b.Source && src.last == b.Barcode {
+			// scanning it again is not a duplicate
+			src.last = ""
+		}
+	}
+	a.counts.remove(b.Direction+"-"+b.CurrierService, b.CreatedAt)
+	a.countsChanged = true
+
+	b.Undo = true
+	b.CreatedAt = time.Now()
+	logger.Infof("undoing barcode: %v", b.Barcode)
+	a.storage.Insert(b)
+	a.updateStatusBar()
+
+	a.screen.WriteLine(2, "Undone: "+b.Barcode)
+	a.successFeedback()
+}
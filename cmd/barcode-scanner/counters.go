@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const dayFormat = "2006-01-02"
+
+// scanMark is a scan kept for the last hour statistics
+type scanMark struct {
+	Key string
+	At  time.Time
+}
+
+// scanCounts counts the scans per direction and currier, persisted with the settings
+type scanCounts struct {
+	// Since is when the counters were last reset (end of shift)
+	Since time.Time
+	Total map[string]int
+	// Day is the date Today counts for
+	Day    string
+	Today  map[string]int
+	Recent []scanMark
+}
+
+func newScanCounts(now time.Time) scanCounts {
+	return scanCounts{
+		Since: now,
+		Total: map[string]int{},
+		Day:   now.Format(dayFormat),
+		Today: map[string]int{},
+	}
+}
+
+func (c *scanCounts) add(key string, now time.Time) {
+	if c.Total == nil {
+		*c = newScanCounts(now)
+	}
+	c.rollover(now)
+
+	c.Total[key]++
+	c.Today[key]++
+	c.Recent = append(c.Recent, scanMark{Key: key, At: now})
+}
+
+// remove uncounts the scan counted at at, ex: an undone one
+func (c *scanCounts) remove(key string, at time.Time) {
+	if !at.Before(c.Since) && c.Total[key] > 0 {
+		c.Total[key]--
+	}
+	if at.Format(dayFormat) == c.Day && c.Today[key] > 0 {
+		c.Today[key]--
+	}
+	for i := len(c.Recent) - 1; i >= 0; i-- {
+		if c.Recent[i].Key == key && c.Recent[i].At.Equal(at) {
+			c.Recent = append(c.Recent[:i], c.Recent[i+1:]...)
+			break
+		}
+	}
+}
+
+// rollover forgets the counts of previous days and scans older than an hour
+func (c *scanCounts) rollover(now time.Time) {
+	if day := now.Format(dayFormat); c.Day != day {
+		c.Day = day
+		c.Today = map[string]int{}
+	}
+
+	hourAgo := now.Add(-time.Hour)
+	i := 0
+	for i < len(c.Recent) && c.Recent[i].At.Before(hourAgo) {
+		i++
+	}
+	c.Recent = c.Recent[i:]
+}
+
+// reset starts counting a new shift, the daily counts are kept
+func (c *scanCounts) reset(now time.Time) {
+	today := c.Today
+	day := c.Day
+	*c = newScanCounts(now)
+	if day == c.Day && today != nil {
+		c.Today = today
+	}
+}
+
+func (c *scanCounts) totals(now time.Time) (total, hour, today int) {
+	c.rollover(now)
+	for _, n := range c.Total {
+		total += n
+	}
+	for _, n := range c.Today {
+		today += n
+	}
+	return total, len(c.Recent), today
+}
+
+// summary is the text sent to the notifier at the end of the shift
+func (c *scanCounts) summary(now time.Time) string {
+	total, hour, today := c.totals(now)
+
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "shift summary %v - %v: %v scans (last hour: %v, today: %v)",
+		c.Since.Format("2006-01-02 15:04"), now.Format("15:04"), total, hour, today,
+	)
+	for _, k := range c.keys() {
+		fmt.Fprintf(&sb, "\n%v: %v", k, c.Total[k])
+	}
+	return sb.String()
+}
+
+// scanSummaryView shows the totals, then the shift counts by direction and currier
+func (a *app) scanSummaryView() *view {
+	return a.infoView("scanSummary", "SCAN COUNTS", func() []string {
+		now := time.Now()
+		total, hour, today := a.counts.totals(now)
+		since := a.counts.Since
+
+		lines := []string{
+			fmt.Sprintf("Shift: %v (%v)", total, since.Format("15:04")),
+			fmt.Sprintf("Hour: %v Today: %v", hour, today),
+		}
+		for _, k := range a.counts.keys() {
+			dir, currier := k, ""
+			if i := strings.IndexByte(k, '-'); i >= 0 {
+				dir, currier = k[:i], a.curriers.Name(k[i+1:])
+			}
+			lines = append(lines, fmt.Sprintf("%v %v: %v", dir, currier, a.counts.Total[k]))
+		}
+		return lines
+	})
+}
+
+// keys returns the direction and currier keys counted in the shift in order
+func (c *scanCounts) keys() []string {
+	keys := make([]string, 0, len(c.Total))
+	for k, n := range c.Total {
+		if n > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countScan counts the scan for the direction and currier it was stored with,
+// the counts are persisted on the status tick, see persistCounts
+func (a *app) countScan(dir direction, currier string, now time.Time) {
+	a.counts.add(dir.String()+"-"+currier, now)
+	a.countsChanged = true
+}
+
+// persistCounts persists the settings if the counts changed since, so the card
+// is not written after every scan
+func (a *app) persistCounts() {
+	if a.countsChanged {
+		a.persistSettings()
+	}
+}
+
+// endShift sends the summary of the shift to the notifier and resets the counters
+func (a *app) endShift() {
+	now := time.Now()
+	msg := a.counts.summary(now)
+	total, _, _ := a.counts.totals(now)
+	a.counts.reset(now)
+	a.persistSettings()
+
+	go func() {
+		if err := a.bot.Send(msg, false); err != nil {
+			logger.Warningf("failed sending shift summary: %v", err)
+		}
+	}()
+
+	a.screen.WriteLine(2, fmt.Sprintf("Shift closed: %v", total))
+}
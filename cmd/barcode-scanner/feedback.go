@@ -1,53 +1,62 @@
 package main
 
 import (
-	"code.sztanpet.net/zvpsz/barcode-scanner/internal/buzzer"
-	"code.sztanpet.net/zvpsz/barcode-scanner/internal/gpio"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/feedback"
 )
 
 func (a *app) onBootup() {
-	if a.cfg.HardwareVersion < 2 {
-		if err := buzzer.StartupBeep(); err != nil {
-			logger.Warningf("buzzer beep error: %v", err)
-		}
-	} else {
-		if err := gpio.Beeper.StartupBeep(); err != nil {
-			logger.Warningf("gpio.Beeper.StartupBeep error: %v", err)
-		}
-		gpio.RedLED.Disable()
-		if err := gpio.GreenLED.Enable(); err != nil {
-			logger.Criticalf("failed to switch green led on: %v", err)
-		}
-	}
+	a.fb.Boot()
 }
 
 func (a *app) onShutdown() {
-	if a.cfg.HardwareVersion >= 2 {
-		gpio.GreenLED.Disable()
-		_ = gpio.RedLED.Enable()
-	}
+	a.clearStatusLEDs()
+	a.fb.Shutdown()
 }
 
+// the feedback is given on the device and on the scanner of the current input,
+// the players do not block the event loop
+
 func (a *app) successFeedback() {
-	if a.cfg.HardwareVersion < 2 {
-		if err := buzzer.StartupBeep(); err != nil {
-			logger.Warningf("buzzer beep error: %v", err)
-		}
-	} else {
-		if err := gpio.Success(a.ctx); err != nil {
-			logger.Infof("gpio.Success failed: %v", err)
-		}
-	}
+	a.sourceFeedback(feedback.Feedback.Success)
 }
 
 func (a *app) failFeedback() {
-	if a.cfg.HardwareVersion < 2 {
-		if err := buzzer.FailBeep(); err != nil {
-			logger.Infof("buzzer.FailBeep failed: %v", err)
-		}
-	} else {
-		if err := gpio.Fail(a.ctx); err != nil {
-			logger.Infof("gpio.Fail failed: %v", err)
-		}
+	a.sourceFeedback(feedback.Feedback.Fail)
+}
+
+func (a *app) warnFeedback() {
+	a.sourceFeedback(feedback.Feedback.Warn)
+}
+
+func (a *app) duplicateFeedback() {
+	a.sourceFeedback(feedback.Feedback.Duplicate)
+}
+
+func (a *app) busyFeedback() {
+	a.sourceFeedback(feedback.Feedback.Busy)
+}
+
+func (a *app) sourceFeedback(give func(feedback.Feedback)) {
+	give(a.fb)
+	if a.src != nil && a.src.fb != nil {
+		give(a.src.fb)
 	}
 }
+
+// scannerFeedback sends the commands to a serial scanner, so it can beep or flash on its own,
+// it is nil when there are no commands
+func (a *app) scannerFeedback(port feedback.Sender) feedback.Feedback {
+	if a.cfg.SerialSuccessCmd == "" && a.cfg.SerialFailCmd == "" {
+		return nil
+	}
+
+	return feedback.New(a.ctx, feedback.Scanner{
+		Port: port,
+		Commands: map[string]string{
+			"success":   a.cfg.SerialSuccessCmd,
+			"fail":      a.cfg.SerialFailCmd,
+			"warn":      a.cfg.SerialFailCmd,
+			"duplicate": a.cfg.SerialFailCmd,
+		},
+	})
+}
@@ -8,17 +8,19 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/config"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/currier"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/display"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/feedback"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/file"
-	"code.sztanpet.net/zvpsz/barcode-scanner/internal/status"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/hardware"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/leds"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/power"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/storage"
-	"code.sztanpet.net/zvpsz/barcode-scanner/internal/telegram"
-	"code.sztanpet.net/zvpsz/barcode-scanner/internal/tty"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/update"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/wifi"
 	"github.com/juju/loggo"
 )
 
@@ -41,33 +43,100 @@ const (
 )
 
 var settingsPath = "barcode-scanner/settings"
-var specialBarcodeRe = regexp.MustCompile(`(?i)(?:^(INGRESS|EGRESS)-(\d+)$|^(W(?:S|P))\$(.+)$)`)
+var specialBarcodeRe = regexp.MustCompile(`(?i)(?:^(INGRESS|EGRESS)-(\d+)$|^(W(?:S|P))\$(.+)$|^(SHIFT-END)$|^OP\$(.+)$|^(LOGOUT)$)`)
 
 type app struct {
-	ctx     context.Context
-	exit    context.CancelFunc
-	cfg     *config.Config
-	screen  *display.Screen
-	status  *status.Status
-	storage *storage.Storage
-	bot     *telegram.Bot
-	upd     *update.Binary
-
-	state       State
+	ctx      context.Context
+	exit     context.CancelFunc
+	cfg      *config.Config
+	hw       *hardware.Profile
+	screen   *display.Screen
+	storage  store
+	curriers *currier.Registry
+	bot      notifier
+	fb       feedback.Feedback
+	// leds show the ongoing states, nil without status leds, see showStatusLEDs
+	leds indicator
+	upd  *update.Binary
+	// storeAndTry is wifi.StoreAndTry, replaced when replaying scripts
+	storeAndTry func(ctx context.Context, cfg *config.Config, acc wifi.Account, progress func(string)) error
+	// wifiSignal is wifi.Signal, replaced when replaying scripts
+	wifiSignal func() (int, error)
+	// powerState reads the power supply, nil without one, see setupPower
+	powerState func() (power.State, error)
+	// powerOff is power.Off, replaced when replaying scripts
+	powerOff func() error
+
+	// events are run on the event loop, see run
+	events chan func()
+
+	// everything below is only used from the event loop
+	views []*view
+	// currentLine is the text typed into the menus, barcodes are read into the line of their source
 	currentLine bytes.Buffer
-	activity    chan struct{}
-	idleTasks   []func()
-	idleStart   time.Time
+	sources     []*source
+	// src is the source of the rune being handled, nil before the first one,
+	// at is when the rune was read from the device, see input.Timed
+	src *source
+	at  time.Time
+	// lastStored is the last barcode stored, nil if none or it was undone
+	lastStored *storage.Barcode
+	// bindings are the sources rebound by a special barcode, by id
+	bindings  map[string]string
+	idleTasks []func()
+	idleStart time.Time
+	bootedAt  time.Time
+	// wifiAcc is filled by the WS$ and WP$ special barcodes
+	wifiAcc wifi.Account
+	// power is the last state of the power supply, nil until read
+	power *power.State
+	// powerLost is when the device went on battery, zero while it is plugged in
+	powerLost time.Time
+	// shuttingDown is set once powering off started, the input is ignored from then
+	shuttingDown bool
+	// cancelShutdown stops powering off while the scans are flushed, nil once it is too late
+	cancelShutdown func()
+	// retryPowerOff is when powering off is tried again after it failed
+	retryPowerOff time.Time
+	// wifi and lowDisk are read on the status tick, see statusTick
+	wifi    int
+	lowDisk bool
+
+	dir      direction
+	currier  string
+	operator string
+	counts   scanCounts
+	// countsChanged is set when the counts changed since the settings were persisted
+	countsChanged bool
+}
+
+// store persists the scanned barcodes, see storage.Storage
+type store interface {
+	Insert(data storage.Barcode)
+	Flush(ctx context.Context) error
+	Pending() int
+	LastInsert() time.Time
+	FreeSpace() (float64, error)
+}
+
+// indicator shows ongoing states on the status leds, see leds.Manager
+type indicator interface {
+	Set(name string, s leds.State)
+	Clear(name string)
+}
 
-	mu      sync.RWMutex
-	dir     direction
-	currier string
+// notifier sends messages to the support channel, see telegram.Bot
+type notifier interface {
+	Send(txt string, disableNotification bool) error
+	SendFile(data []byte, filename string, disableNotification bool) error
 }
 
 var logger = loggo.GetLogger("barcode-scanner")
 var (
 	idleDurr   = 1 * time.Hour
 	statusDurr = 5 * time.Minute
+	// currierSyncDurr is how often the curriers are synced from the database
+	currierSyncDurr = 10 * time.Minute
 )
 
 func init() {
@@ -78,36 +147,53 @@ func main() {
 	cfg := config.Get()
 	ctx, exit := context.WithCancel(context.Background())
 	a := &app{
-		ctx:     ctx,
-		exit:    exit,
-		cfg:     cfg,
-		currier: "0",
+		ctx:         ctx,
+		exit:        exit,
+		cfg:         cfg,
+		events:      make(chan func()),
+		storeAndTry: wifi.StoreAndTry,
+		wifiSignal:  wifi.Signal,
+		powerOff:    power.Off,
+		currier:     "0",
+		bootedAt:    time.Now(),
 	}
 
 	// handle signals first
 	a.handleSignals()
 
-	a.setupTelegram()
+	bot := a.setupTelegram()
 	// logging sends messages to telegram, so it depends on it
-	a.setupLogging()
+	a.setupLogging(bot)
 	// sends to telegram
-	a.status = status.New(a.ctx, a.bot)
+	a.setupStatus(bot)
+	// the drivers of the screen and the feedback depend on it
+	a.setupHardware()
+	// only depends on the hardware, watched once the event loop runs
+	a.setupPower()
 	// depends on statePath => config
-	a.setupStorage()
+	db := a.setupStorage()
+	// synced from the database unless configured
+	a.setupCurriers(db)
 	// no deps
 	a.setupScreen()
 
 	// updates are low-prio and only depend on statePath
 	a.setupUpdate()
-	// restore settings set by the user, only the inputLoop uses the info
+	// restore settings set by the user, only the event loop uses the info
 	a.setupSettings()
 	a.setupWiFi()
-	a.setupDeviceID()
-
-	go a.inputLoop()
-	go a.idleLoop()
+	a.setupDeviceID(db)
+
+	// the inputs route the feedback to the scanners
+	a.setupFeedback()
+	a.setupInputs()
+	a.setupButtons()
+	keys := make(chan keypress, keysBuffer)
+	a.readInputs(keys)
+	a.readButtons(keys)
+	go a.run(keys)
+	a.watchPower()
 
-	a.setupHardware()
 	a.onBootup()
 
 	// canceling the context is the normal way to exit
@@ -133,6 +219,11 @@ func (a *app) handleTelegramMessage(msg string) {
 		return
 	}
 
+	if strings.EqualFold(msg, "!screenshot barcode-scanner") {
+		a.sendScreenshot()
+		return
+	}
+
 	const pfx = "!log barcode-scanner "
 	if len(msg) < len(pfx) || !strings.EqualFold(msg[:len(pfx)], pfx) {
 		return
@@ -153,71 +244,78 @@ func (a *app) handleTelegramMessage(msg string) {
 	logger.Debugf("logging spec successfully applied, spec was: %v", spec)
 }
 
-func (a *app) inputLoop() {
-	in, err := tty.Open(a.ctx)
+// sendScreenshot uploads the frame currently on the screen, so support can see
+// exactly what the operator sees
+func (a *app) sendScreenshot() {
+	data, err := a.screen.Snapshot()
 	if err != nil {
-		logger.Criticalf("tty open error: %v", err)
-		os.Exit(1)
+		logger.Warningf("failed taking screenshot: %v", err)
+		return
 	}
-	defer in.RestoreTermMode()
-
-	a.enterReadBarcode()
-
-	for {
-		select {
-		case <-a.ctx.Done():
-			return
-		default:
-		}
 
-		r, _, err := in.ReadRune()
-		if err != nil {
-			// pretty expected error since we only provide support for a subset of inputs
-			logger.Debugf("read rune error: %v", err)
-			continue
-		}
-
-		// provide a way to exit the app directly from the keyboard
-		if r == 4 {
-			logger.Warningf("ctrl+d pressed, exiting")
-			a.exit()
-			return
-		}
+	filename := "screen" + time.Now().Format("_20060102_150405")
+	if a.screen.Blanked() {
+		filename += "_blanked"
+	}
 
-		// mark activity
-		select {
-		case a.activity <- struct{}{}:
-		default:
-		}
+	if err := a.bot.SendFile(data, filename+".png", true); err != nil {
+		logger.Warningf("sending screenshot failed: %v", err)
+	}
+}
 
-		a.transitionState(r)
+// do runs f on the event loop, goroutines hand their results to the app with it
+func (a *app) do(f func()) {
+	select {
+	case <-a.ctx.Done():
+	case a.events <- f:
 	}
 }
 
-func (a *app) idleLoop() {
+// run is the event loop of the app, the views, the settings and the idle tasks
+// are only ever touched from here, so they need no locking
+func (a *app) run(keys <-chan keypress) {
 	if a.ctx.Err() != nil {
 		return
 	}
 
-	a.status.Check()
+	a.push(a.readBarcodeView())
+	a.statusTick()
 
-	st := time.NewTicker(statusDurr)
+	sb := time.NewTicker(statusBarDurr)
 	it := time.NewTimer(idleDurr)
+	defer sb.Stop()
+	defer it.Stop()
 	for {
 		select {
-		case <-a.activity:
-			// activity signalled => not idle, reset timer
+		case <-a.ctx.Done():
+			a.persistCounts()
+			return
+
+		case k := <-keys:
+			// activity => not idle, reset timer
 			if !it.Stop() {
-				<-it.C
+				select {
+				case <-it.C:
+				default:
+				}
 			}
 			_ = it.Reset(idleDurr)
 			a.idleStart = time.Time{}
 
-		case <-st.C:
-			a.status.Check()
-			if a.screen.ShouldBlank() {
-				a.screen.Blank()
+			// the screen dims and blanks itself when idle, any key or scan restores it
+			a.screen.Wake()
+			if k.button != "" {
+				a.handleButton(k.button)
+				break
 			}
+			a.src, a.at = k.src, k.at
+			a.handleInput(k.r)
+
+		case f := <-a.events:
+			f()
+
+		case <-sb.C:
+			a.statusTick()
 
 		case <-it.C:
 			if a.idleStart.IsZero() {
@@ -227,24 +325,36 @@ func (a *app) idleLoop() {
 			for _, task := range a.idleTasks {
 				task()
 			}
+			// keep running the tasks while idle
+			_ = it.Reset(idleDurr)
 		}
 	}
 }
 
+// addIdleTask registers f to run on the event loop when idle, it must be called before run
 func (a *app) addIdleTask(f func()) {
-	// TODO locking?
 	a.idleTasks = append(a.idleTasks, f)
 }
 
-func (a *app) persistSettingsLocked() {
-	s := &struct {
-		Direction int
-		Currier   string
-		IdleStart time.Time
-	}{
+// settings are the choices of the user restored on startup
+type settings struct {
+	Direction int
+	Currier   string
+	IdleStart time.Time
+	Counts    scanCounts
+	Operator  string
+	Bindings  map[string]string
+}
+
+func (a *app) persistSettings() {
+	a.countsChanged = false
+	s := &settings{
 		Direction: int(a.dir),
 		Currier:   a.currier,
 		IdleStart: a.idleStart,
+		Counts:    a.counts,
+		Operator:  a.operator,
+		Bindings:  a.bindings,
 	}
 
 	path := filepath.Join(a.cfg.StatePath, settingsPath)
@@ -264,21 +374,17 @@ func (a *app) loadSettings() {
 		return
 	}
 
-	s := &struct {
-		Direction int
-		Currier   string
-		IdleStart time.Time
-	}{}
+	s := &settings{}
 
 	if err := file.Unserialize(path, s); err != nil {
 		logger.Warningf("Failed to unserialize settings: %v", err)
 	}
 
-	a.mu.Lock()
-	defer a.mu.Unlock()
-
 	a.dir = direction(s.Direction)
 	a.currier = s.Currier
 	a.idleStart = s.IdleStart
-	logger.Debugf("Restored settings (dir=%v, currier=%v, idleStart=%v)", s.Direction, s.Currier, s.IdleStart)
+	a.counts = s.Counts
+	a.operator = s.Operator
+	a.bindings = s.Bindings
+	logger.Debugf("Restored settings (dir=%v, currier=%v, idleStart=%v, operator=%v, bindings=%v)", s.Direction, s.Currier, s.IdleStart, s.Operator, s.Bindings)
 }
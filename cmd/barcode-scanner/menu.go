@@ -0,0 +1,313 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/tty"
+)
+
+/*
+The app is a stack of views, the input goes to the view on the top.
+The root view is readBarcode, it is never popped.
+The views run on the event loop (see run), other goroutines reach them through a.do.
+
+readBarcode:
+  - on escape -> mainMenu
+  - on up arrow -> wifiPrint
+  - on down arrow -> scanSummary
+  - on enter -> handle the barcode in the line of the source it was read from
+    special barcodes are not inserted into db
+    INGRESS-n/EGRESS-n rebinds the source if it has a binding, see source
+    lines typed by hand instead of scanned -> manualEntry, or rejected, see input.Timing
+    SHIFT-END sends the scan counts to telegram and resets them
+    OP$<id> logs the operator in, LOGOUT logs them out
+  - on invalid char -> ignore
+  - on valid char -> append to the line of the source
+
+mainMenu (menu views: arrows select, enter activates, escape goes back):
+  - Wi-Fi setup -> wifiSetupSSID -> wifiSetupPW -> wifiSetupDone
+  - Wi-Fi info -> wifiPrint
+  - Direction -> directionPicker
+  - Scan counts -> scanSummary
+  - Diagnostics
+  - About
+
+wifiSetupSSID, wifiSetupPW (text input views):
+  - on escape -> back
+  - on valid char -> append to currentLine, display on screen
+  - on backspace/delete -> delete last char from currentLine, display on screen
+  - on enter -> save currentLine, next step
+wifiSetupDone:
+  - also entered from the special barcodes that set the ssid and pw directly
+  - display pre-setup message on screen
+  - do setup in the background, showing the steps on screen, input is ignored
+  - show result on screen
+  - wait 2 seconds so user can read it
+  - return to readBarcode
+manualEntry (menu view):
+  - Discard (selected first, so the enter of a scan cannot store it) or Store flagged as manual
+wifiPrint, scanSummary, Diagnostics, About:
+  - display info, on pressing anything but the runes of a scan, go back
+
+scans on the other views than readBarcode and wifiSetupDone:
+  - a line ending like a scan is stored in the background instead of being input,
+    special barcodes and the scans during the shutdown are rejected
+
+buttons (any view, see buttons.go):
+  - the presses run the configured action: toggle the direction, undo the last scan,
+    wifiPrint, mainMenu or back to readBarcode
+
+shutdown (any view, see power.go):
+  - on battery past the grace period or with the battery running out
+  - flush the pending scans, then power off, the input and the buttons are ignored
+  - back to the view before when the power returns during the flush or powering off fails
+*/
+
+// view is a screen of the app: it draws itself when entered,
+// and handles the input while it is on the top of the view stack
+type view struct {
+	name string
+	// enter draws the view, it is called when the view is pushed
+	// and when the view above it is popped
+	enter func()
+	// exit is called when the view is popped or replaced
+	exit func()
+	// keys are the actions for special keys, they take precedence over input
+	keys map[rune]func()
+	// input handles every other rune, nil ignores them
+	input func(r rune)
+	// scans is set on views reading the barcodes themselves, on the others
+	// the scans are stored in the background, see handleScanInput
+	scans bool
+}
+
+func (a *app) top() *view {
+	return a.views[len(a.views)-1]
+}
+
+func (a *app) viewNames() string {
+	names := make([]string, 0, len(a.views))
+	for _, v := range a.views {
+		names = append(names, v.name)
+	}
+	return strings.Join(names, " > ")
+}
+
+// push enters the view on top of the current one
+func (a *app) push(v *view) {
+	a.views = append(a.views, v)
+	logger.Debugf("view: push %v (%v)", v.name, a.viewNames())
+	a.resetLines()
+	v.enter()
+}
+
+// replace swaps the view on the top, for steps of a flow that should not be returned to
+func (a *app) replace(v *view) {
+	a.exitTop()
+	a.views[len(a.views)-1] = v
+	logger.Debugf("view: replace with %v (%v)", v.name, a.viewNames())
+	a.resetLines()
+	v.enter()
+}
+
+// pop returns to the previous view, the root view is never popped
+func (a *app) pop() {
+	if len(a.views) <= 1 {
+		return
+	}
+
+	a.exitTop()
+	a.views = a.views[:len(a.views)-1]
+	logger.Debugf("view: pop (%v)", a.viewNames())
+	a.resetLines()
+	a.top().enter()
+}
+
+// home returns to the root view
+func (a *app) home() {
+	if len(a.views) <= 1 {
+		return
+	}
+
+	for len(a.views) > 1 {
+		a.exitTop()
+		a.views = a.views[:len(a.views)-1]
+	}
+	logger.Debugf("view: home (%v)", a.viewNames())
+	a.resetLines()
+	a.top().enter()
+}
+
+func (a *app) exitTop() {
+	if v := a.top(); v.exit != nil {
+		v.exit()
+	}
+}
+
+// handleInput routes the input to the view on the top, except for the scans
+// the view does not read
+func (a *app) handleInput(r rune) {
+	v := a.top()
+	if !v.scans && a.src != nil && a.handleScanInput(r) {
+		return
+	}
+
+	if f, ok := v.keys[r]; ok {
+		f()
+		return
+	}
+
+	if v.input != nil {
+		v.input(r)
+	}
+}
+
+type menuItem struct {
+	label  string
+	action func()
+}
+
+// menuView lists the items two at a time, the arrows move the selection,
+// enter activates the selected item and escape goes back
+func (a *app) menuView(name, title string, items []menuItem) *view {
+	sel := 0
+	draw := func() {
+		// page through the items, the selected one is marked
+		first := sel / 2 * 2
+		for i := 0; i < 2; i++ {
+			line := ""
+			if first+i < len(items) {
+				line = "  " + items[first+i].label
+				if first+i == sel {
+					line = "> " + items[first+i].label
+				}
+			}
+			a.screen.WriteLine(1+i, line)
+		}
+	}
+
+	return &view{
+		name: name,
+		enter: func() {
+			a.screen.Clear()
+			a.screen.WriteTitle(title)
+			a.screen.WriteHelp("(ESC back, ENTER select)")
+			draw()
+		},
+		keys: map[rune]func(){
+			tty.KeyArrowUp: func() {
+				sel = (sel + len(items) - 1) % len(items)
+				draw()
+			},
+			tty.KeyArrowDown: func() {
+				sel = (sel + 1) % len(items)
+				draw()
+			},
+			'\n': func() {
+				items[sel].action()
+			},
+			tty.KeyEscape: a.pop,
+		},
+	}
+}
+
+// infoView shows the lines returned by info two at a time, the arrows page
+// through them, any other key but the runes of barcodes goes back
+func (a *app) infoView(name, title string, info func() []string) *view {
+	var lines []string
+	page := 0
+	draw := func() {
+		for i := 0; i < 2; i++ {
+			line := ""
+			if page*2+i < len(lines) {
+				line = lines[page*2+i]
+			}
+			a.screen.WriteLine(1+i, line)
+		}
+	}
+	pages := func() int {
+		return (len(lines) + 1) / 2
+	}
+
+	help := "(ENTER to return)"
+	return &view{
+		name: name,
+		enter: func() {
+			lines = info()
+			page = 0
+			a.screen.Clear()
+			a.screen.WriteTitle(title)
+			if pages() > 1 {
+				help = "(arrows: more, ENTER: return)"
+			}
+			a.screen.WriteHelp(help)
+			draw()
+		},
+		keys: map[rune]func(){
+			tty.KeyArrowUp: func() {
+				if pages() > 1 {
+					page = (page + pages() - 1) % pages()
+					draw()
+				}
+			},
+			tty.KeyArrowDown: func() {
+				if pages() > 1 {
+					page = (page + 1) % pages()
+					draw()
+				}
+			},
+		},
+		input: func(r rune) {
+			// the first rune of a scan would leave the rest of it to the view below
+			if r <= unicode.MaxASCII && unicode.IsPrint(r) {
+				return
+			}
+			a.pop()
+		},
+	}
+}
+
+// textInputView reads a line of text into currentLine, enter hands the non-empty
+// line to done, escape goes back
+func (a *app) textInputView(name, title, prompt string, done func(line string)) *view {
+	return &view{
+		name: name,
+		enter: func() {
+			a.screen.Clear()
+			a.screen.WriteTitle(title)
+			a.screen.WriteLine(1, prompt)
+			a.screen.WriteLine(2, "")
+			a.screen.WriteHelp("(ESC to cancel)")
+		},
+		keys: map[rune]func(){
+			'\n': func() {
+				if line := a.currentLine.String(); len(line) > 0 {
+					done(line)
+				}
+			},
+			tty.KeyEscape:    a.pop,
+			tty.KeyBackspace: a.deleteLastRune,
+			tty.KeyDelete:    a.deleteLastRune,
+		},
+		input: func(r rune) {
+			if unicode.IsPrint(r) {
+				_, _ = a.currentLine.WriteRune(r)
+				a.screen.WriteLine(2, a.currentLine.String())
+			}
+		},
+	}
+}
+
+func (a *app) deleteLastRune() {
+	// https://stackoverflow.com/questions/39907667/how-to-remove-unicode-characters-from-byte-buffer-in-go
+	if a.currentLine.Len() >= 1 {
+		b := a.currentLine.Bytes()
+		_, n := utf8.DecodeLastRune(b)
+		a.currentLine.Truncate(len(b) - n)
+
+		a.screen.WriteLine(2, a.currentLine.String())
+		logger.Tracef("deleteLastRune: backspace")
+	}
+}
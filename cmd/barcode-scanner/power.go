@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/power"
+)
+
+var (
+	// powerPollDurr is how often the power supply is read
+	powerPollDurr = time.Second
+	// powerLossGrace is how long the device runs on battery before powering off,
+	// unless configured, so swapping the plug does not power it off
+	powerLossGrace = 30 * time.Second
+	// flushDurr is how long the pending scans are tried to be inserted before powering off
+	flushDurr = 15 * time.Second
+)
+
+// watchPower reads the power supply regularly and hands its state to the event loop
+func (a *app) watchPower() {
+	if a.powerState == nil {
+		return
+	}
+
+	go func() {
+		t := time.NewTicker(powerPollDurr)
+		defer t.Stop()
+
+		failing := false
+		for {
+			st, err := a.powerState()
+			if err != nil && !failing {
+				logger.Warningf("reading the power supply failed: %v", err)
+			}
+			failing = err != nil
+			if err == nil {
+				a.do(func() {
+					a.handlePower(st)
+				})
+			}
+
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// handlePower follows the state of the power supply, on battery the device powers off
+// after the grace period or when the battery is about to run out
+func (a *app) handlePower(st power.State) {
+	changed := a.power == nil || *a.power != st
+	a.power = &st
+	if a.shuttingDown {
+		if st.OnBattery || a.cancelShutdown == nil {
+			return
+		}
+		// plugged in again before powering off
+		logger.Criticalf("powering off cancelled, battery at %v%%", st.Battery)
+		a.cancelShutdown()
+		a.endShutdown()
+	}
+
+	switch {
+	case st.OnBattery && a.powerLost.IsZero():
+		logger.Warningf("power lost, battery at %v%%", st.Battery)
+		a.powerLost = time.Now()
+		a.screen.Wake()
+		a.fb.Warn()
+	case !st.OnBattery && !a.powerLost.IsZero():
+		logger.Infof("power restored, battery at %v%%", st.Battery)
+		a.powerLost = time.Time{}
+	}
+	if changed {
+		a.updateStatusBar()
+	}
+	if !st.OnBattery || time.Now().Before(a.retryPowerOff) {
+		return
+	}
+
+	if since := time.Since(a.powerLost); since >= a.powerGrace() {
+		a.powerDown(fmt.Sprintf("on battery for %v", since.Round(time.Second)))
+	} else if st.Battery >= 0 && st.Battery <= a.cfg.PowerOffBattery {
+		a.powerDown(fmt.Sprintf("battery at %v%%", st.Battery))
+	}
+}
+
+// powerDown flushes the pending scans and powers off, nothing is scanned from then,
+// systemd stops the app before powering off, so it exits like on any other signal,
+// the power coming back during the flush or powering off failing returns to scanning
+func (a *app) powerDown(reason string) {
+	logger.Criticalf("powering off, %v", reason)
+	a.shuttingDown = true
+	a.persistCounts()
+	a.screen.Wake()
+	a.push(a.shutdownView())
+
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.cancelShutdown = cancel
+	go func() {
+		fctx, fcancel := context.WithTimeout(ctx, flushDurr)
+		err := a.storage.Flush(fctx)
+		fcancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// they are on the disk, inserted after the next boot
+			logger.Warningf("flushing the storage failed: %v", err)
+		}
+
+		a.do(func() {
+			if ctx.Err() != nil {
+				// the power came back meanwhile
+				return
+			}
+			a.cancelShutdown = nil
+			a.screen.WriteLine(2, "Powering off")
+
+			go func() {
+				err := a.powerOff()
+				if err == nil {
+					return
+				}
+
+				a.do(func() {
+					logger.Criticalf("power off failed: %v", err)
+					a.endShutdown()
+					a.retryPowerOff = time.Now().Add(a.powerGrace())
+					a.screen.WriteLine(2, "Power off failed")
+					a.fb.Fail()
+				})
+			}()
+		})
+	}()
+}
+
+// endShutdown returns to scanning from the shutdown view
+func (a *app) endShutdown() {
+	a.shuttingDown = false
+	a.cancelShutdown = nil
+	a.pop()
+}
+
+// powerGrace is how long the device runs on battery, a failed power off is retried after it too
+func (a *app) powerGrace() time.Duration {
+	if a.cfg.PowerLossGrace > 0 {
+		return a.cfg.PowerLossGrace
+	}
+	return powerLossGrace
+}
+
+// shutdownView ignores the input, there is no way back once powering off started
+func (a *app) shutdownView() *view {
+	return &view{
+		name: "shutdown",
+		enter: func() {
+			a.screen.Clear()
+			a.screen.WriteTitle("SHUTDOWN")
+			a.screen.WriteLine(1, "Power lost")
+			a.screen.WriteLine(2, "Saving scans…")
+			a.screen.WriteHelp("scanning stopped")
+		},
+	}
+}
@@ -5,34 +5,37 @@ import (
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/input"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/storage"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/tty"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/wifi"
 )
 
-func (a *app) handleReadBarcode(r rune) {
-	switch r {
-	case tty.KeyEscape:
-		logger.Debugf("State: readBarcode -> wifiSetup (escape pressed)")
-		a.enterWifiSetup()
-		return
-	case tty.KeyArrowUp:
-		logger.Debugf("State: readBarcode -> wifiPrint (up pressed)")
-		a.enterWifiPrint()
-		return
-
-	case '\n':
-		a.handleBarcodeDone()
-	default:
-		a.handleBarcodeInput(r)
+// readBarcodeView is the root view, barcodes are read and stored while it is shown
+func (a *app) readBarcodeView() *view {
+	return &view{
+		name:  "readBarcode",
+		enter: a.enterReadBarcode,
+		keys: map[rune]func(){
+			tty.KeyEscape: func() {
+				a.push(a.mainMenuView())
+			},
+			tty.KeyArrowUp: func() {
+				a.push(a.wifiPrintView())
+			},
+			tty.KeyArrowDown: func() {
+				a.push(a.scanSummaryView())
+			},
+			'\n': a.handleBarcodeDone,
+		},
+		input: a.handleBarcodeInput,
+		scans: true,
 	}
 }
 
-// enterReadBarcode is called by cancelWifiSetup and doneWifiSetup
 func (a *app) enterReadBarcode() {
-	a.state = readBarcode
-	a.currentLine.Reset()
-
 	// clear and init screen
 	a.screen.Clear()
 	a.writeBarcodeTitle()
@@ -40,41 +43,62 @@ func (a *app) enterReadBarcode() {
 	a.screen.WriteHelp("waiting for scan")
 }
 
+// writeBarcodeTitle shows the direction, currier and operator, when readBarcode is shown
+// the direction and currier are the ones the last used source stores its scans with
 func (a *app) writeBarcodeTitle() {
+	if a.top().name != "readBarcode" {
+		return
+	}
+
+	dir, currier := a.scanTarget(a.src)
 	var t string
-	if a.dir == EGRESS {
-		t = "EGRESS-"
-	} else if a.dir == INGRESS {
-		t = "INGRESS-"
+	if a.src != nil && a.src.bound && len(a.sources) > 1 {
+		t = a.src.id + ":"
+	}
+	if dir == EGRESS {
+		t += "EGRESS-"
+	} else if dir == INGRESS {
+		t += "INGRESS-"
 	} else {
-		panic(fmt.Sprintf("a.dir value is unexpected: %v", a.dir))
+		panic(fmt.Sprintf("direction value is unexpected: %v", dir))
+	}
+	t += a.curriers.Name(currier)
+	if !a.curriers.Known(currier) {
+		// the currier was removed or deactivated since it was picked
+		t += "?"
+	}
+	if a.operator != "" {
+		t += " " + a.operator
 	}
-	t += a.currier
 
 	a.screen.WriteTitle(t)
 }
 
-// handleBarcodeInput is only called by transitionState
-// it appends the new rune to a.currentLine and displays it on the screen
+// handleBarcodeInput is only called by readBarcodeView
+// it appends the new rune to the line of the source it was read from
 func (a *app) handleBarcodeInput(r rune) {
 	if r > unicode.MaxASCII || !unicode.IsPrint(r) {
 		logger.Debugf("handleBarcodeInput: got invalid input: %x %q, ignoring", r, r)
 		return
 	}
 
-	_, _ = a.currentLine.WriteRune(r)
+	_, _ = a.src.line.WriteRune(r)
+	a.src.times = append(a.src.times, a.at)
 }
 
-// handleBarcodeDone signals that a new barcode is available in a.currentLine
+// handleBarcodeDone signals that a new barcode is available in the line of the source
 func (a *app) handleBarcodeDone() {
-	bc := a.currentLine.String()
-	a.currentLine.Reset()
+	bc := a.src.line.String()
+	scanned := a.scanTiming().Scanned(append(a.src.times, a.at))
+	a.src.reset()
+	// the title follows the source last scanned with
+	a.writeBarcodeTitle()
 
 	line := strings.TrimSpace(bc)
 	if len(line) == 0 {
 		logger.Debugf("handleBarcodeInput: empty currentLine, skipping")
 
-		go a.failFeedback()
+		a.failFeedback()
 		return
 	}
 
@@ -83,20 +107,174 @@ func (a *app) handleBarcodeDone() {
 		return
 	}
 
-	a.mu.RLock()
+	if !scanned {
+		a.handleManualEntry(bc)
+		return
+	}
+
+	a.storeBarcode(bc, a.src, false)
+}
+
+// handleManualEntry decides about a line typed by hand instead of scanned, see config.ManualEntry
+func (a *app) handleManualEntry(bc string) {
+	logger.Debugf("line typed by hand on input %v: %v", a.src.id, bc)
+
+	switch a.cfg.ManualEntry {
+	case "accept":
+		a.storeBarcode(bc, a.src, true)
+	case "reject":
+		a.screen.WriteLine(2, "Typed: "+bc)
+		a.failFeedback()
+	default:
+		a.push(a.manualEntryView(bc, a.src))
+	}
+}
+
+// manualEntryView asks whether to store a typed line, discarding it is the default
+// so the enter at the end of a scan cannot store it by accident
+func (a *app) manualEntryView(bc string, src *source) *view {
+	return a.menuView("manualEntry", "TYPED, NOT SCANNED", []menuItem{
+		{"Discard " + bc, func() {
+			a.pop()
+			a.failFeedback()
+		}},
+		{"Store " + bc, func() {
+			a.pop()
+			a.storeBarcode(bc, src, true)
+		}},
+	})
+}
+
+// handleScanInput follows the lines of the sources on the views not reading barcodes,
+// a line ending like a scan is a barcode instead of keys for the view, from a second
+// scanner or from one scanning by mistake, it returns whether the rune was taken
+func (a *app) handleScanInput(r rune) bool {
+	if r != '\n' {
+		if r <= unicode.MaxASCII && unicode.IsPrint(r) {
+			_, _ = a.src.line.WriteRune(r)
+			a.src.times = append(a.src.times, a.at)
+		}
+		return false
+	}
+
+	bc := a.src.line.String()
+	// a single rune and enter cannot be told from typing
+	scanned := len(a.src.times) > 1 && a.scanTiming().Scanned(append(a.src.times, a.at))
+	a.src.reset()
+	if strings.TrimSpace(bc) == "" || !scanned {
+		return false
+	}
+
+	// the text inputs got the runes of the scan too, maybe between typed ones
+	if line, ok := withoutRunes(a.currentLine.String(), bc); ok {
+		a.currentLine.Reset()
+		_, _ = a.currentLine.WriteString(line)
+		a.screen.WriteLine(2, line)
+	}
+
+	logger.Infof("scanned on view %v from input %v: %v", a.top().name, a.src.id, bc)
+	switch {
+	case a.shuttingDown:
+		a.failFeedback()
+	case specialBarcodeRe.MatchString(bc):
+		// they change what is shown, only while reading barcodes
+		a.failFeedback()
+	default:
+		a.storeBarcode(bc, a.src, false)
+	}
+	return true
+}
+
+// withoutRunes removes the runes of sub from the end of s, they may be mixed with others,
+// it returns whether every rune of sub was found
+func withoutRunes(s, sub string) (string, bool) {
+	rs, subs := []rune(s), []rune(sub)
+	j := len(subs) - 1
+	for i := len(rs) - 1; i >= 0 && j >= 0; i-- {
+		if rs[i] == subs[j] {
+			rs = append(rs[:i], rs[i+1:]...)
+			j--
+		}
+	}
+	if j >= 0 {
+		return s, false
+	}
+	return string(rs), true
+}
+
+// scanTiming returns the thresholds telling scans from typing, see input.Timing
+func (a *app) scanTiming() input.Timing {
+	t := input.DefaultTiming
+	if a.cfg.ScanMaxGap > 0 {
+		t.MaxGap = a.cfg.ScanMaxGap
+	}
+	if a.cfg.ScanMaxAvgGap > 0 {
+		t.MaxAvgGap = a.cfg.ScanMaxAvgGap
+	}
+	return t
+}
+
+// storeBarcode stores the barcode read from src with the direction and currier of the source,
+// the result is only shown while reading barcodes
+func (a *app) storeBarcode(bc string, src *source, manual bool) {
+	show := func(line string) {
+		if a.top().scans {
+			a.screen.WriteLine(2, line)
+		}
+	}
+	show(bc)
+
+	dir, currier := a.scanTarget(src)
 	b := storage.Barcode{
 		Barcode:        bc,
-		Direction:      a.dir.String(),
-		CurrierService: a.currier,
+		Direction:      dir.String(),
+		CurrierService: currier,
+		Operator:       a.operator,
+		Source:         src.id,
+		Manual:         manual,
 		CreatedAt:      time.Now(),
 	}
-	a.mu.RUnlock()
+	a.countScan(dir, currier, b.CreatedAt)
+	matches := a.curriers.Matches(currier, bc)
+	duplicate := src.last == bc
+	src.last = bc
 	logger.Tracef("inserting barcode: %#v", b)
 	a.storage.Insert(b)
+	a.lastStored = &b
+	a.updateStatusBar()
 
-	go a.successFeedback()
+	if !matches {
+		// stored anyway, but the operator should check the direction and currier
+		logger.Debugf("barcode does not match the pattern of currier %v: %v", b.CurrierService, bc)
+		show("Not " + a.curriers.Name(b.CurrierService) + ": " + bc)
+		a.warnFeedback()
+		return
+	}
+	if duplicate {
+		// stored anyway, the parcel may have been scanned twice by mistake
+		show("Again: " + bc)
+		a.duplicateFeedback()
+		return
+	}
+
+	a.successFeedback()
+}
+
+// logout ends the session of the operator, scans are not attributed to anyone afterwards
+func (a *app) logout() {
+	if a.operator == "" {
+		return
+	}
+
+	logger.Infof("operator logged out: %v", a.operator)
+	a.operator = ""
+	a.persistSettings()
+	a.writeBarcodeTitle()
 }
 
+// maxOperatorLen is the length of the operator column of the database
+const maxOperatorLen = 64
+
 func (a *app) handleSpecialBarcode(bc string) bool {
 	matches := specialBarcodeRe.FindStringSubmatch(bc)
 	if matches == nil {
@@ -104,40 +282,73 @@ func (a *app) handleSpecialBarcode(bc string) bool {
 	}
 	logger.Tracef("special barcode matched: %v", matches)
 
-	a.mu.Lock()
-	defer a.mu.Unlock()
-
-	if matches[3] != "" {
+	if matches[5] != "" {
+		// end of shift
+		a.endShift()
+	} else if matches[6] != "" {
+		// operator badge, it is stored with every scan in a varchar(64)
+		if utf8.RuneCountInString(matches[6]) > maxOperatorLen || strings.ContainsAny(matches[6], " \t") {
+			logger.Warningf("invalid operator badge: %q", matches[6])
+			a.screen.WriteLine(2, "Invalid badge")
+			a.failFeedback()
+			return true
+		}
+		a.operator = matches[6]
+		logger.Infof("operator logged in: %v", a.operator)
+		a.persistSettings()
+		a.writeBarcodeTitle()
+	} else if matches[7] != "" {
+		a.logout()
+	} else if matches[3] != "" {
 		// barcode for wifi setup
 		switch matches[3] {
 		case "WS":
-			WiFiAcc.SSID = matches[4]
+			a.wifiAcc.SSID = matches[4]
 		case "WP":
-			WiFiAcc.PW = matches[4]
+			a.wifiAcc.PW = matches[4]
 		default:
 			logger.Tracef("wifi barcode matching failed, regex matches were: %#v", matches)
 			return false
 		}
 
-		if WiFiAcc.SSID != "" && WiFiAcc.PW != "" {
-			a.enterWifiSetupDone()
+		if a.wifiAcc.SSID != "" && a.wifiAcc.PW != "" {
+			acc := a.wifiAcc
+			a.wifiAcc = wifi.Account{}
+			a.push(a.wifiSetupDoneView(acc))
 		}
 	} else {
 		// direction and currier handling
-		switch strings.ToUpper(matches[1]) {
-		case "EGRESS":
-			a.dir = EGRESS
-		case "INGRESS":
-			a.dir = INGRESS
-		default:
-			panic("unexpected direction: " + matches[1])
+		if !a.curriers.Known(matches[2]) {
+			logger.Warningf("unknown currier on special barcode: %v", bc)
+			a.screen.WriteLine(2, "Unknown currier "+matches[2])
+			a.failFeedback()
+			return true
 		}
 
-		a.currier = matches[2]
+		if a.src.bound {
+			// a scanner with its own binding only rebinds itself
+			target := strings.ToUpper(matches[1]) + "-" + matches[2]
+			a.src.bind(target)
+			if a.bindings == nil {
+				a.bindings = map[string]string{}
+			}
+			a.bindings[a.src.id] = target
+			logger.Infof("input %v rebound to %v", a.src.id, target)
+		} else {
+			switch strings.ToUpper(matches[1]) {
+			case "EGRESS":
+				a.dir = EGRESS
+			case "INGRESS":
+				a.dir = INGRESS
+			default:
+				panic("unexpected direction: " + matches[1])
+			}
+			a.currier = matches[2]
+		}
 
-		a.persistSettingsLocked()
+		a.persistSettings()
 		a.writeBarcodeTitle()
 	}
-	go a.successFeedback()
+	a.successFeedback()
 	return true
 }
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/config"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/currier"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/display"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/feedback"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/hardware"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/input"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/leds"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/power"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/storage"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/wifi"
+)
+
+/*
+Replaying scripts boots the app with fake devices: a virtual screen, in-memory storage,
+recorded feedback and notifications, and a wifi setup that does not touch the network.
+The input comes from the script, see input.Step for the commands, on top of them:
+
+  curriers 3=GLS,5=DPD          configures the curriers, like the CURRIERS env var
+  manual confirm|reject|accept  what happens to typed lines, like the MANUAL_ENTRY env var
+  input <id> [<DIRECTION>-<currier>]
+                                adds an input besides the script, like the INPUTS env var,
+                                the input "script" configures the binding of the script itself
+  buttons <button>[:long]=<action>,...
+                                maps the button presses to actions, like the BUTTON_ACTIONS env var
+  grace <duration>              how long the device runs on battery, like the POWER_LOSS_GRACE env var
+  from <id> <text>              the text arrives like from a scanner on the input, followed by enter
+  press <button>[:long]         the button is pressed, or held for a long press
+  pending <n>                   n scans are waiting for the database from now on
+  busy <duration>               the event loop is blocked for the duration, the script goes on
+  signal <percent>|off          the wifi signal from now on, 100 by default, read on the next tick
+  tick                          the status tick reads the wifi signal and the free space
+  power on|off [<battery %>]    the external power and the battery from now on,
+                                there is only a power supply if the script uses it
+  poweroff ok|fail              whether powering off works from now on
+  expect screen <line> <text>   the line of the screen (0: title, 3: help) is the text
+  expect view <name>            the view on the top is name
+  expect stored <barcode> <direction>-<currier> [operator]
+                                the next stored barcode
+  expect source <id>            the last stored barcode was read from the input
+  expect manual true|false      the last stored barcode was typed by hand
+  expect undo true|false        the last stored barcode cancels the one before it
+  expect feedback <name>        the next feedback given to the operator, see feedback.Patterns
+  expect leds [<state>,...]     the states set on the status leds, in order, see statusLEDs
+  expect sent <text>            the next notification contains the text
+  expect poweroff               the device was powered off
+
+Expectations are retried until expectTimeout, so they can wait for the app to catch up.
+The wifi setup fails for the password "wrong".
+
+ex: go test -race ./cmd/barcode-scanner -run TestReplay/scan.txt
+*/
+
+var expectTimeout = 3 * time.Second
+
+// TestReplay replays every script in testdata
+func TestReplay(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no scripts to replay")
+	}
+
+	// polled faster, so the grace periods of the scripts can be short
+	powerPollDurr = 50 * time.Millisecond
+
+	for _, p := range paths {
+		p := p
+		t.Run(filepath.Base(p), func(t *testing.T) {
+			if err := replayScript(p); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+type replayer struct {
+	a        *app
+	storage  *storage.Memory
+	notifier *replayNotifier
+	feedback *replayFeedback
+	// inputs are the inputs added besides the script, by id
+	inputs map[string]*replayInput
+	// keys are read by the app, the button presses are sent to it
+	keys chan keypress
+	leds *leds.Manager
+	// wifi is the signal strength, negative when not connected
+	wifi int32
+	// supply is the state of the power supply, poweredOff is set once it was powered off,
+	// powerOffFails makes powering off fail
+	supplyMu      sync.Mutex
+	supply        power.State
+	poweredOff    int32
+	powerOffFails int32
+	// stored and sent are the number of rows and messages already expected
+	stored, sent int
+}
+
+func replayScript(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	steps, err := input.ParseScript(f)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "barcode-scanner-replay")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &config.Config{
+		StatePath:       dir,
+		MachineID:       "00000000000000000000000000000000",
+		HardwareProfile: "v2",
+		PowerOffBattery: 10,
+	}
+	// the config has to be complete before booting
+	var script []input.Step
+	hasPower := false
+	inputs := []config.Input{{ID: "script"}}
+	for _, st := range steps {
+		switch st.Cmd {
+		case "curriers":
+			if cfg.Curriers, err = config.ParseCurriers(st.Arg); err != nil {
+				return fmt.Errorf("%v: %v", st, err)
+			}
+		case "manual":
+			cfg.ManualEntry = st.Arg
+		case "buttons":
+			if cfg.ButtonActions, err = config.ParseButtonActions(st.Arg); err != nil {
+				return fmt.Errorf("%v: %v", st, err)
+			}
+		case "grace":
+			if cfg.PowerLossGrace, err = time.ParseDuration(st.Arg); err != nil {
+				return fmt.Errorf("%v: %v", st, err)
+			}
+		case "input":
+			fields := strings.Fields(st.Arg)
+			if len(fields) == 0 || len(fields) > 2 {
+				return fmt.Errorf("%v: invalid input", st)
+			}
+			in := config.Input{ID: fields[0]}
+			if len(fields) > 1 {
+				in.Binding = fields[1]
+			}
+			if in.ID == "script" {
+				inputs[0] = in
+			} else {
+				inputs = append(inputs, in)
+			}
+		default:
+			hasPower = hasPower || st.Cmd == "power"
+			script = append(script, st)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := &replayer{
+		storage:  storage.NewMemory(),
+		notifier: &replayNotifier{},
+		feedback: &replayFeedback{},
+		inputs:   map[string]*replayInput{},
+		keys:     make(chan keypress, keysBuffer),
+		wifi:     100,
+		supply:   power.State{Battery: 100},
+		leds: leds.New(func(pattern.LED) error {
+			return nil
+		}),
+	}
+	// the fake devices replace the drivers, the profile is only shown
+	hw := hardware.Profiles[cfg.HardwareProfile]
+	r.a = &app{
+		ctx:         ctx,
+		exit:        cancel,
+		cfg:         cfg,
+		hw:          &hw,
+		screen:      display.NewScreenWithDevice(ctx, display.NewVirtual()),
+		storage:     r.storage,
+		curriers:    currier.New(cfg),
+		bot:         r.notifier,
+		fb:          feedback.New(ctx, r.feedback),
+		leds:        r.leds,
+		storeAndTry: replayStoreAndTry,
+		wifiSignal:  r.signal,
+		powerOff:    r.powerOff,
+		events:      make(chan func()),
+		currier:     "0",
+		bootedAt:    time.Now(),
+	}
+	if hasPower {
+		r.a.powerState = r.readPower
+	}
+	r.a.setupSettings()
+	r.a.setupButtons()
+
+	src := input.NewScript(ctx, script, r.step)
+	defer src.Close()
+	for _, in := range inputs {
+		if in.ID == "script" {
+			r.a.addSource(in.ID, src, nil, in.Binding)
+			continue
+		}
+
+		ri := &replayInput{ctx: ctx, runes: make(chan rune)}
+		r.inputs[in.ID] = ri
+		r.a.addSource(in.ID, ri, nil, in.Binding)
+	}
+
+	r.a.readInputs(r.keys)
+	go r.a.run(r.keys)
+	r.a.watchPower()
+
+	select {
+	case <-src.Done():
+		return src.Err()
+	case <-ctx.Done():
+		return errors.New("the app exited")
+	}
+}
+
+// step handles the commands of the script that are not input
+func (r *replayer) step(st input.Step) error {
+	if st.Cmd == "from" {
+		parts := strings.SplitN(st.Arg, " ", 2)
+		ri, ok := r.inputs[parts[0]]
+		if !ok || len(parts) < 2 {
+			return errors.New("unknown input")
+		}
+		return ri.scan(parts[1])
+	}
+	if st.Cmd == "press" {
+		select {
+		case <-r.a.ctx.Done():
+			return r.a.ctx.Err()
+		case r.keys <- keypress{button: st.Arg, at: time.Now()}:
+		}
+		return nil
+	}
+	if st.Cmd == "signal" {
+		n := -1
+		if st.Arg != "off" {
+			var err error
+			if n, err = strconv.Atoi(st.Arg); err != nil {
+				return err
+			}
+		}
+		atomic.StoreInt32(&r.wifi, int32(n))
+		return nil
+	}
+	if st.Cmd == "tick" {
+		r.a.do(r.a.statusTick)
+		return nil
+	}
+	if st.Cmd == "power" {
+		fields := strings.Fields(st.Arg)
+		if len(fields) == 0 || len(fields) > 2 || (fields[0] != "on" && fields[0] != "off") {
+			return errors.New("invalid power")
+		}
+
+		r.supplyMu.Lock()
+		defer r.supplyMu.Unlock()
+		r.supply.OnBattery = fields[0] == "off"
+		if len(fields) > 1 {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return err
+			}
+			r.supply.Battery = n
+		}
+		return nil
+	}
+	if st.Cmd == "poweroff" {
+		switch st.Arg {
+		case "ok":
+			atomic.StoreInt32(&r.powerOffFails, 0)
+		case "fail":
+			atomic.StoreInt32(&r.powerOffFails, 1)
+		default:
+			return errors.New("invalid poweroff")
+		}
+		return nil
+	}
+	if st.Cmd == "busy" {
+		d, err := time.ParseDuration(st.Arg)
+		if err != nil {
+			return err
+		}
+
+		started := make(chan struct{})
+		go r.a.do(func() {
+			close(started)
+			time.Sleep(d)
+		})
+		<-started
+		return nil
+	}
+	if st.Cmd == "pending" {
+		n, err := strconv.Atoi(st.Arg)
+		if err != nil {
+			return err
+		}
+		r.storage.SetPending(n)
+		return nil
+	}
+	if st.Cmd != "expect" {
+		return errors.New("unknown command")
+	}
+
+	deadline := time.Now().Add(expectTimeout)
+	for {
+		err := r.expect(st.Arg)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (r *replayer) expect(arg string) error {
+	parts := strings.SplitN(arg, " ", 2)
+	want := ""
+	if len(parts) > 1 {
+		want = parts[1]
+	}
+
+	switch parts[0] {
+	case "screen":
+		lp := strings.SplitN(want, " ", 2)
+		line, err := strconv.Atoi(lp[0])
+		if err != nil {
+			return err
+		}
+		text := ""
+		if len(lp) > 1 {
+			text = lp[1]
+		}
+
+		lines := r.a.screen.Lines()
+		if line < 0 || line >= len(lines) {
+			return fmt.Errorf("no line %v on the screen", line)
+		}
+		if lines[line] != text {
+			return fmt.Errorf("screen line %v is %q, expected %q", line, lines[line], text)
+		}
+
+	case "view":
+		names := make(chan string, 1)
+		r.a.do(func() {
+			names <- r.a.top().name
+		})
+		if name := <-names; name != want {
+			return fmt.Errorf("view is %q, expected %q", name, want)
+		}
+
+	case "stored":
+		rows := r.storage.Rows()
+		if len(rows) <= r.stored {
+			return errors.New("nothing stored")
+		}
+		row := rows[r.stored]
+		got := strings.TrimSpace(fmt.Sprintf("%v %v-%v %v", row.Barcode, row.Direction, row.CurrierService, row.Operator))
+		if got != want {
+			return fmt.Errorf("stored %q, expected %q", got, want)
+		}
+		r.stored++
+
+	case "source":
+		rows := r.storage.Rows()
+		if r.stored == 0 || len(rows) < r.stored {
+			return errors.New("nothing stored")
+		}
+		if got := rows[r.stored-1].Source; got != want {
+			return fmt.Errorf("stored from %q, expected %q", got, want)
+		}
+
+	case "manual":
+		rows := r.storage.Rows()
+		if r.stored == 0 || len(rows) < r.stored {
+			return errors.New("nothing stored")
+		}
+		if got := strconv.FormatBool(rows[r.stored-1].Manual); got != want {
+			return fmt.Errorf("stored with manual %v, expected %v", got, want)
+		}
+
+	case "undo":
+		rows := r.storage.Rows()
+		if r.stored == 0 || len(rows) < r.stored {
+			return errors.New("nothing stored")
+		}
+		if got := strconv.FormatBool(rows[r.stored-1].Undo); got != want {
+			return fmt.Errorf("stored with undo %v, expected %v", got, want)
+		}
+
+	case "feedback":
+		got, ok := r.feedback.next()
+		if !ok {
+			return errors.New("no feedback")
+		}
+		if got != want {
+			return fmt.Errorf("feedback was %q, expected %q", got, want)
+		}
+
+	case "leds":
+		if got := strings.Join(r.leds.States(), ","); got != want {
+			return fmt.Errorf("leds show %q, expected %q", got, want)
+		}
+
+	case "poweroff":
+		if atomic.LoadInt32(&r.poweredOff) == 0 {
+			return errors.New("not powered off")
+		}
+
+	case "sent":
+		msgs := r.notifier.messages()
+		if len(msgs) <= r.sent {
+			return errors.New("nothing sent")
+		}
+		if !strings.Contains(msgs[r.sent], want) {
+			return fmt.Errorf("sent %q, expected it to contain %q", msgs[r.sent], want)
+		}
+		r.sent++
+
+	default:
+		return errors.New("unknown expectation")
+	}
+
+	return nil
+}
+
+// signal pretends to measure the wifi signal
+func (r *replayer) signal() (int, error) {
+	n := int(atomic.LoadInt32(&r.wifi))
+	if n < 0 {
+		return 0, errors.New("not connected")
+	}
+	return n, nil
+}
+
+// readPower pretends to read the power supply
+func (r *replayer) readPower() (power.State, error) {
+	r.supplyMu.Lock()
+	defer r.supplyMu.Unlock()
+
+	return r.supply, nil
+}
+
+// powerOff pretends to power off, the app keeps running
+func (r *replayer) powerOff() error {
+	if atomic.LoadInt32(&r.powerOffFails) != 0 {
+		return errors.New("poweroff failed")
+	}
+	atomic.StoreInt32(&r.poweredOff, 1)
+	return nil
+}
+
+// replayStoreAndTry pretends to set up the wifi
+func replayStoreAndTry(ctx context.Context, cfg *config.Config, acc wifi.Account, progress func(string)) error {
+	for _, step := range []string{"Saving…", "Connecting…"} {
+		progress(step)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if acc.PW == "wrong" {
+		return errors.New("secrets were required, but not provided")
+	}
+	return nil
+}
+
+// replayInput is an input besides the script, the from command scans with it
+type replayInput struct {
+	ctx   context.Context
+	runes chan rune
+}
+
+func (i *replayInput) scan(text string) error {
+	for _, r := range text + "\n" {
+		select {
+		case <-i.ctx.Done():
+			return i.ctx.Err()
+		case i.runes <- r:
+		}
+		time.Sleep(input.ScanDelay)
+	}
+	return nil
+}
+
+func (i *replayInput) ReadRune() (rune, int, error) {
+	select {
+	case <-i.ctx.Done():
+		return 0, 0, io.EOF
+	case r := <-i.runes:
+		return r, 1, nil
+	}
+}
+
+func (i *replayInput) Close() error {
+	return nil
+}
+
+// replayNotifier records the messages instead of sending them
+type replayNotifier struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (n *replayNotifier) Send(txt string, disableNotification bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.msgs = append(n.msgs, txt)
+	return nil
+}
+
+func (n *replayNotifier) SendFile(data []byte, filename string, disableNotification bool) error {
+	return n.Send("file: "+filename, disableNotification)
+}
+
+func (n *replayNotifier) messages() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]string(nil), n.msgs...)
+}
+
+// replayFeedback records the patterns played, the expectations consume them in order
+type replayFeedback struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (f *replayFeedback) Play(ctx context.Context, p pattern.Pattern) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.events = append(f.events, p.Name)
+	return nil
+}
+
+func (f *replayFeedback) next() (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.events) == 0 {
+		return "", false
+	}
+	ev := f.events[0]
+	f.events = f.events[1:]
+	return ev, true
+}
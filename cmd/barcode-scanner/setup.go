@@ -8,9 +8,14 @@ import (
 	"time"
 
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/buzzer"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/currier"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/display"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/feedback"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/gpio"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/hardware"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/logwriter"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/power"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/status"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/storage"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/telegram"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/update"
@@ -32,12 +37,12 @@ func (a *app) handleSignals() {
 	}()
 }
 
-func (a *app) setupLogging() {
+func (a *app) setupLogging(bot *telegram.Bot) {
 	if a.ctx.Err() != nil {
 		return
 	}
 
-	err := logwriter.Setup(a.bot, a.cfg)
+	err := logwriter.Setup(bot, a.cfg)
 	if err != nil {
 		panic("logwriter setup failed, impossible: " + err.Error())
 	}
@@ -69,9 +74,9 @@ func (a *app) setupUpdate() {
 	})
 }
 
-func (a *app) setupStorage() {
+func (a *app) setupStorage() *storage.Storage {
 	if a.ctx.Err() != nil {
-		return
+		return nil
 	}
 
 	storage, err := storage.New(a.ctx, a.cfg)
@@ -81,12 +86,47 @@ func (a *app) setupStorage() {
 	}
 
 	a.storage = storage
+	return storage
 }
 
-func (a *app) setupDeviceID() {
+func (a *app) setupCurriers(db *storage.Storage) {
+	if a.ctx.Err() != nil {
+		return
+	}
+
+	a.curriers = currier.New(a.cfg)
+	if a.curriers.Static() {
+		return
+	}
+
 	go func() {
 		for {
-			did, err := a.storage.SetupDevice(a.cfg)
+			err := a.curriers.Sync(a.ctx, db.Curriers)
+			if err != nil {
+				logger.Debugf("failed to sync curriers, retrying in a minute, err: %v", err)
+			}
+
+			durr := currierSyncDurr
+			if err != nil {
+				durr = 1 * time.Minute
+			}
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-time.After(durr):
+			}
+		}
+	}()
+}
+
+func (a *app) setupDeviceID(db *storage.Storage) {
+	if a.ctx.Err() != nil {
+		return
+	}
+
+	go func() {
+		for {
+			did, err := db.SetupDevice(a.cfg)
 			if err == nil {
 				logger.Tracef("got deviceid: %v", did)
 				return
@@ -97,20 +137,44 @@ func (a *app) setupDeviceID() {
 	}()
 }
 
-func (a *app) setupTelegram() {
+func (a *app) setupTelegram() *telegram.Bot {
 	if a.ctx.Err() != nil {
-		return
+		return nil
 	}
 
-	a.bot = telegram.New(a.ctx, a.cfg)
-	_ = a.bot.Send("BS-start @ "+time.Now().Format(time.RFC3339), true)
+	bot := telegram.New(a.ctx, a.cfg)
+	a.bot = bot
+	_ = bot.Send("BS-start @ "+time.Now().Format(time.RFC3339), true)
 
 	go func() {
 		for {
-			_ = a.bot.HandleMessage(a.handleTelegramMessage, false)
+			_ = bot.HandleMessage(a.handleTelegramMessage, false)
 			time.Sleep(1 * time.Minute)
 		}
 	}()
+	return bot
+}
+
+// setupStatus sends the status of the system to telegram regularly
+func (a *app) setupStatus(bot *telegram.Bot) {
+	if a.ctx.Err() != nil {
+		return
+	}
+
+	st := status.New(a.ctx, bot)
+	go func() {
+		t := time.NewTicker(statusDurr)
+		defer t.Stop()
+		for {
+			st.Check()
+
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
 }
 
 func (a *app) setupScreen() {
@@ -118,7 +182,8 @@ func (a *app) setupScreen() {
 		return
 	}
 
-	screen, err := display.NewScreen(a.ctx)
+	opts := a.hw.DisplayOpts(a.cfg)
+	screen, err := display.NewScreen(a.ctx, &opts)
 	if err != nil {
 		// screen handles its own logging, just exit
 		fmt.Printf("screen err: %v", err)
@@ -134,42 +199,94 @@ func (a *app) setupScreen() {
 	a.screen.WriteHelp("scanner ready")
 }
 
+// setupHardware loads the hardware profile, everything driving the hardware depends on it
 func (a *app) setupHardware() {
-	if a.cfg.HardwareVersion < 2 {
-		a.setupBuzzer()
-	} else {
-		a.setupGPIO()
+	hw, err := hardware.Load(a.cfg.HardwareProfile)
+	if err != nil {
+		logger.Criticalf("failed loading the hardware profile: %v", err)
+		os.Exit(1)
+	}
+	a.hw = hw
+
+	if err := hw.SetupRTC(); err != nil {
+		logger.Warningf("rtc setup error: %v", err)
 	}
 }
 
-func (a *app) setupBuzzer() {
+// setupPower opens the UPS HAT or the battery of the hardware profile, see watchPower
+func (a *app) setupPower() {
 	if a.ctx.Err() != nil {
 		return
 	}
 
-	if err := buzzer.Setup(); err != nil {
-		logger.Warningf("buzzer setup error: %v", err)
+	opts := a.hw.PowerOpts(a.cfg)
+	src, err := power.Open(&opts)
+	if err != nil {
+		logger.Criticalf("power supply disabled: %v", err)
+		return
+	}
+	if src != nil {
+		a.powerState = src.Read
 	}
 }
 
-func (a *app) setupGPIO() {
-	if a.ctx.Err() != nil {
-		return
+// setupFeedback picks the feedback driver, the one of the hardware profile by default
+func (a *app) setupFeedback() {
+	name := a.cfg.FeedbackDriver
+	if name == "" {
+		name = a.hw.Feedback
+	}
+	if name == "" {
+		name = "none"
 	}
 
-	if err := gpio.Setup(); err != nil {
-		logger.Criticalf("GPIO setup failed: %v", err)
-		return
+	newDriver, ok := feedback.Drivers[name]
+	if !ok {
+		logger.Criticalf("unknown feedback driver: %v", name)
+		os.Exit(1)
+	}
+
+	switch name {
+	case "buzzer":
+		opts := a.hw.BuzzerOpts()
+		if err := buzzer.Setup(&opts); err != nil {
+			logger.Warningf("buzzer setup error: %v", err)
+		}
+	case "gpio":
+		opts := a.hw.GPIOOpts(a.cfg)
+		if err := gpio.Setup(&opts); err != nil {
+			logger.Criticalf("GPIO setup failed: %v", err)
+		}
+		a.leds = gpio.LEDs
 	}
+
+	for name, tones := range a.cfg.FeedbackTones {
+		if err := feedback.SetTones(name, tones); err != nil {
+			logger.Criticalf("FEEDBACK_TONES: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	a.fb = feedback.New(a.ctx, newDriver())
 }
 
 func (a *app) setupSettings() {
 	a.loadSettings()
 	a.addIdleTask(func() {
-		if a.inExtendedIdle() && (a.dir != EGRESS || a.currier != "0") {
+		if a.inExtendedIdle() && a.operator != "" {
+			a.logout()
+		}
+	})
+	a.addIdleTask(func() {
+		if a.inExtendedIdle() && (a.dir != EGRESS || a.currier != "0" || len(a.bindings) > 0) {
 			a.dir = EGRESS
 			a.currier = "0"
-			a.persistSettingsLocked()
+			// the rebound sources return to their configured binding
+			a.bindings = nil
+			for _, s := range a.sources {
+				s.bind(s.binding)
+			}
+			a.persistSettings()
 			a.writeBarcodeTitle()
 			a.screen.Blank()
 		}
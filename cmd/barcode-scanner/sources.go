@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/config"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/evdev"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/feedback"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/input"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/serial"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/tty"
+)
+
+// source is a scanner the barcodes are read from, every source has its own line buffer
+// so scans of different scanners do not mix
+type source struct {
+	id string
+	in input.Source
+	// fb is the feedback given on the scanner itself for its scans, nil if it takes no commands
+	fb feedback.Feedback
+	// line is the barcode being read and times are when its runes were read,
+	// only used from the event loop
+	line  bytes.Buffer
+	times []time.Time
+	// last is the last barcode stored from the source, to notice duplicates
+	last string
+
+	// bound sources store their scans with their own direction and currier
+	// instead of the ones picked on the screen
+	bound   bool
+	dir     direction
+	currier string
+	// binding is the configured one, restored when idle
+	binding string
+}
+
+// keysBuffer is how many keypresses wait while the event loop is busy,
+// so the sources keep reading the devices
+const keysBuffer = 256
+
+// keypress is a rune read from a source or the press of a button, see readButtons
+type keypress struct {
+	src *source
+	r   rune
+	at  time.Time
+	// button is the press of a button, <button> or <button>:long, src and r are unset
+	button string
+}
+
+// parseTarget parses a <DIRECTION>-<currier>, ex: INGRESS-3
+func parseTarget(s string) (direction, string, bool) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", false
+	}
+
+	switch strings.ToUpper(parts[0]) {
+	case "EGRESS":
+		return EGRESS, parts[1], true
+	case "INGRESS":
+		return INGRESS, parts[1], true
+	}
+	return 0, "", false
+}
+
+// bind sets the direction and currier of the source, an empty target unbinds it
+func (s *source) bind(target string) {
+	s.bound = false
+	if target == "" {
+		return
+	}
+
+	dir, currier, ok := parseTarget(target)
+	if !ok {
+		logger.Warningf("invalid binding of input %v: %v", s.id, target)
+		return
+	}
+	s.bound, s.dir, s.currier = true, dir, currier
+}
+
+func (s *source) reset() {
+	s.line.Reset()
+	s.times = s.times[:0]
+}
+
+// scanTarget returns the direction and currier the scans of the source are stored with
+func (a *app) scanTarget(s *source) (direction, string) {
+	if s != nil && s.bound {
+		return s.dir, s.currier
+	}
+	return a.dir, a.currier
+}
+
+// addSource registers a source, it must be called before run
+func (a *app) addSource(id string, in input.Source, fb feedback.Feedback, binding string) *source {
+	s := &source{id: id, in: in, fb: fb, binding: binding}
+	s.bind(binding)
+	if target, ok := a.bindings[id]; ok && binding != "" {
+		// rebound by a special barcode before the restart
+		s.bind(target)
+	}
+	a.sources = append(a.sources, s)
+	return s
+}
+
+// resetLines forgets the text typed into the views and the line of the current source,
+// the other sources may be in the middle of a scan
+func (a *app) resetLines() {
+	a.currentLine.Reset()
+	if a.src != nil {
+		a.src.reset()
+	}
+}
+
+// setupInputs opens the devices the scanners are read from, see config.Inputs
+// the settings have to be loaded before, they have the bindings
+func (a *app) setupInputs() {
+	for _, in := range a.cfg.Inputs {
+		src, fb := a.openInput(in)
+		a.addSource(in.ID, src, fb, in.Binding)
+		logger.Debugf("opened input %v (%v)", in.ID, in.Driver)
+	}
+}
+
+// openInput opens an input, with the feedback of the scanner if it can take commands
+func (a *app) openInput(in config.Input) (input.Source, feedback.Feedback) {
+	switch in.Driver {
+	case "tty":
+		src, err := tty.Open(a.ctx)
+		if err != nil {
+			logger.Criticalf("tty open error: %v", err)
+			os.Exit(1)
+		}
+		if a.cfg.ConsoleLayout != a.cfg.KeyboardLayout {
+			src.Remap(layout(a.cfg.ConsoleLayout), layout(a.cfg.KeyboardLayout))
+		}
+		return src, nil
+
+	case "evdev":
+		src, err := evdev.Open(a.ctx, in.Path, in.Vendor, in.Product, layout(a.cfg.KeyboardLayout))
+		if err != nil {
+			logger.Criticalf("evdev open error on input %v: %v", in.ID, err)
+			os.Exit(1)
+		}
+		return src, nil
+
+	case "serial":
+		opts := serial.DefaultOpts
+		if a.cfg.SerialPath != "" {
+			opts.Path = a.cfg.SerialPath
+		}
+		if in.Path != "" {
+			opts.Path = in.Path
+		}
+		if a.cfg.SerialBaud != 0 {
+			opts.Baud = a.cfg.SerialBaud
+		}
+		if a.cfg.SerialFraming != "" {
+			opts.Framing = a.cfg.SerialFraming
+		}
+		opts.Terminator = a.cfg.SerialTerminator
+		opts.Prefix = a.cfg.SerialPrefix
+		opts.Suffix = a.cfg.SerialSuffix
+
+		src, err := serial.Open(a.ctx, opts)
+		if err != nil {
+			logger.Criticalf("serial open error on input %v: %v", in.ID, err)
+			os.Exit(1)
+		}
+
+		return src, a.scannerFeedback(src)
+	}
+
+	logger.Criticalf("unknown input driver: %v", in.Driver)
+	os.Exit(1)
+	return nil, nil
+}
+
+// layout returns the keyboard layout by name, see tty.Layouts
+func layout(name string) tty.Layout {
+	l, ok := tty.Layouts[name]
+	if !ok {
+		logger.Criticalf("unknown keyboard layout: %v, supported: %v", name, tty.LayoutNames())
+		os.Exit(1)
+	}
+	return l
+}
+
+// readInputs starts reading every source, the runes are handed to the event loop
+func (a *app) readInputs(keys chan<- keypress) {
+	for _, s := range a.sources {
+		go a.readInput(s, keys)
+	}
+}
+
+// readInput reads the source and hands the runes to the event loop
+func (a *app) readInput(s *source, keys chan<- keypress) {
+	defer s.in.Close()
+
+	for {
+		r, _, err := s.in.ReadRune()
+		if a.ctx.Err() != nil {
+			return
+		}
+		if err == io.EOF {
+			logger.Debugf("input %v closed", s.id)
+			return
+		}
+		if err != nil {
+			// pretty expected error since we only provide support for a subset of inputs
+			logger.Debugf("read rune error on input %v: %v", s.id, err)
+			continue
+		}
+
+		// provide a way to exit the app directly from the keyboard,
+		// the other inputs may pass the byte on from the scanned data
+		if _, ok := s.in.(*tty.TTY); ok && r == 4 {
+			logger.Warningf("ctrl+d pressed, exiting")
+			a.exit()
+			return
+		}
+
+		// the sources knowing better tell when the rune arrived
+		at := time.Now()
+		if t, ok := s.in.(input.Timed); ok && !t.ReadTime().IsZero() {
+			at = t.ReadTime()
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case keys <- keypress{src: s, r: r, at: at}:
+		}
+	}
+}
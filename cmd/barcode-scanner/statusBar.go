@@ -0,0 +1,114 @@
+package main
+
+import (
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/display"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/leds"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
+)
+
+var (
+	statusBarDurr = 15 * time.Second
+	// dbDownDurr is how long scans can be pending without a successful insert before warning
+	dbDownDurr = 10 * time.Minute
+	// lowDiskPerc is the free space percentage under which the disk is considered full
+	lowDiskPerc = 10.0
+)
+
+// statusTick reads the wifi signal and the free space for the status bar, those touch /proc
+// and the filesystem, so they are only read every statusBarDurr instead of after every scan,
+// the scan counts are persisted then too
+func (a *app) statusTick() {
+	a.persistCounts()
+
+	signal, err := a.wifiSignal()
+	if err != nil {
+		logger.Tracef("wifiSignal failed: %v", err)
+		signal = -1
+	}
+	a.wifi = signal
+
+	free, err := a.storage.FreeSpace()
+	if err != nil {
+		logger.Warningf("storage.FreeSpace failed: %v", err)
+	}
+	a.lowDisk = err == nil && free < lowDiskPerc
+
+	a.updateStatusBar()
+}
+
+// updateStatusBar collects the state shown in the title bar icons, the slow parts are
+// the ones of the last statusTick
+func (a *app) updateStatusBar() {
+	st := display.Status{
+		Pending: a.storage.Pending(),
+		WiFi:    a.wifi,
+		LowDisk: a.lowDisk,
+		Battery: -1,
+		Time:    time.Now(),
+	}
+	if a.power != nil {
+		st.Battery, st.OnBattery = a.power.Battery, a.power.OnBattery
+	}
+
+	last := a.storage.LastInsert()
+	if last.IsZero() {
+		last = a.bootedAt
+	}
+	st.DBDown = st.Pending > 0 && time.Since(last) > dbDownDurr
+
+	a.screen.SetStatus(st)
+	a.showStatusLEDs(st)
+}
+
+// statusLEDs are the ongoing states shown on the status leds by name, above the rest of the
+// feedback patterns and below their flashes, healthy is the solid green rest
+var statusLEDs = map[string]leds.State{
+	// scans waiting for the database
+	"pending": leds.Blink(10, pattern.Blue, 0, time.Second),
+	// scans waiting for the database without a network
+	"offline": leds.Blink(20, pattern.Red, pattern.Blue, time.Second),
+	// an update is downloaded, the app restarts when idle
+	"updating": leds.Blink(25, pattern.Green, pattern.Blue, 250*time.Millisecond),
+	// scans are not reaching the database, see dbDownDurr
+	"dbdown": leds.Blink(30, pattern.Red, 0, 150*time.Millisecond),
+	// the spool is about to run out of space
+	"lowdisk": leds.Solid(40, pattern.Red),
+	// the power is lost, the device powers off soon, see handlePower
+	"battery": leds.Blink(45, pattern.Red, pattern.Green, 500*time.Millisecond),
+}
+
+// showStatusLEDs sets the states of the status on the leds, if there are any
+func (a *app) showStatusLEDs(st display.Status) {
+	if a.leds == nil {
+		return
+	}
+
+	active := map[string]bool{
+		"pending":  st.Pending > 0,
+		"offline":  st.Pending > 0 && st.WiFi < 0,
+		"updating": a.upd != nil && a.upd.ShouldRestart(),
+		"dbdown":   st.DBDown,
+		"lowdisk":  st.LowDisk,
+		"battery":  st.OnBattery,
+	}
+	for name, on := range active {
+		if on {
+			a.leds.Set(name, statusLEDs[name])
+		} else {
+			a.leds.Clear(name)
+		}
+	}
+}
+
+// clearStatusLEDs leaves the leds to the feedback, ex: to show the shutdown
+func (a *app) clearStatusLEDs() {
+	if a.leds == nil {
+		return
+	}
+
+	for name := range statusLEDs {
+		a.leds.Clear(name)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/currier"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/tty"
+)
+
+func (a *app) mainMenuView() *view {
+	return a.menuView("mainMenu", "MENU", []menuItem{
+		{"Wi-Fi setup", func() { a.push(a.wifiSetupView()) }},
+		{"Wi-Fi info", func() { a.push(a.wifiPrintView()) }},
+		{"Direction", func() { a.push(a.directionView()) }},
+		{"Scan counts", func() { a.push(a.scanSummaryView()) }},
+		{"Diagnostics", func() { a.push(a.diagnosticsView()) }},
+		{"About", func() { a.push(a.aboutView()) }},
+	})
+}
+
+// directionView picks the direction and the currier, from the configured list if there is one
+func (a *app) directionView() *view {
+	if curriers := a.curriers.Active(); len(curriers) > 0 {
+		return a.directionPickerView(curriers)
+	}
+
+	pick := func(dir direction) func() {
+		return func() {
+			a.replace(a.currierInputView(dir))
+		}
+	}
+
+	return a.menuView("direction", "DIRECTION", []menuItem{
+		{"EGRESS", pick(EGRESS)},
+		{"INGRESS", pick(INGRESS)},
+	})
+}
+
+// directionPickerView toggles the direction with the left/right arrows
+// and steps through the configured curriers with the up/down arrows
+func (a *app) directionPickerView(curriers []currier.Currier) *view {
+	dir := a.dir
+	sel := 0
+	for i, c := range curriers {
+		if c.ID == a.currier {
+			sel = i
+		}
+	}
+
+	draw := func() {
+		a.screen.WriteLine(1, "< "+dir.String()+" >")
+		a.screen.WriteLine(2, curriers[sel].ID+" "+curriers[sel].Name)
+	}
+	toggle := func() {
+		if dir == EGRESS {
+			dir = INGRESS
+		} else {
+			dir = EGRESS
+		}
+		draw()
+	}
+
+	return &view{
+		name: "directionPicker",
+		enter: func() {
+			a.screen.Clear()
+			a.screen.WriteTitle("DIRECTION")
+			a.screen.WriteHelp("(ARROWS change, ENTER save)")
+			draw()
+		},
+		keys: map[rune]func(){
+			tty.KeyArrowLeft:  toggle,
+			tty.KeyArrowRight: toggle,
+			tty.KeyArrowUp: func() {
+				sel = (sel + len(curriers) - 1) % len(curriers)
+				draw()
+			},
+			tty.KeyArrowDown: func() {
+				sel = (sel + 1) % len(curriers)
+				draw()
+			},
+			'\n': func() {
+				a.setDirection(dir, curriers[sel].ID)
+			},
+			tty.KeyEscape: a.pop,
+		},
+	}
+}
+
+func (a *app) currierInputView(dir direction) *view {
+	return a.textInputView("currier", dir.String(), "Currier number:", func(line string) {
+		if _, err := strconv.Atoi(line); err != nil || !a.curriers.Known(line) {
+			a.currentLine.Reset()
+			a.screen.WriteLine(2, "")
+			a.failFeedback()
+			return
+		}
+
+		a.setDirection(dir, line)
+	})
+}
+
+// setDirection stores the direction and currier picked in the menu, then returns to readBarcode
+func (a *app) setDirection(dir direction, currier string) {
+	a.dir = dir
+	a.currier = currier
+	a.persistSettings()
+
+	logger.Debugf("direction set from menu: %v-%v", dir.String(), currier)
+	a.successFeedback()
+	a.home()
+}
+
+func (a *app) diagnosticsView() *view {
+	return a.infoView("diagnostics", "DIAGNOSTICS", func() []string {
+		lines := []string{"IP: " + localIP()}
+
+		if signal, err := a.wifiSignal(); err != nil {
+			lines = append(lines, "Wi-Fi: n/a")
+		} else {
+			lines = append(lines, fmt.Sprintf("Wi-Fi: %v%%", signal))
+		}
+
+		lines = append(lines, fmt.Sprintf("Pending: %v", a.storage.Pending()))
+		if last := a.storage.LastInsert(); last.IsZero() {
+			lines = append(lines, "Last DB: never")
+		} else {
+			lines = append(lines, "Last DB: "+last.Format("01-02 15:04"))
+		}
+
+		if free, err := a.storage.FreeSpace(); err != nil {
+			lines = append(lines, "Disk free: n/a")
+		} else {
+			lines = append(lines, fmt.Sprintf("Disk free: %.0f%%", free))
+		}
+		if a.power != nil {
+			supply := "plugged"
+			if a.power.OnBattery {
+				supply = "battery"
+			}
+			if a.power.Battery >= 0 {
+				supply += fmt.Sprintf(" %v%%", a.power.Battery)
+			}
+			lines = append(lines, "Power: "+supply)
+		}
+		lines = append(lines, "Up: "+time.Since(a.bootedAt).Truncate(time.Minute).String())
+
+		return lines
+	})
+}
+
+func (a *app) aboutView() *view {
+	return a.infoView("about", "ABOUT", func() []string {
+		version := "unknown"
+		if a.upd != nil {
+			version = a.upd.Version()
+			if len(version) > 12 {
+				version = version[:12]
+			}
+		}
+
+		return []string{
+			"Version: " + version,
+			"HW: " + a.hw.Name,
+			"ID: " + a.cfg.MachineID[:8],
+		}
+	})
+}
+
+// localIP returns the first non-loopback IPv4 address of the machine
+func localIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		logger.Tracef("net.InterfaceAddrs failed: %v", err)
+		return "n/a"
+	}
+
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.To4() == nil {
+			continue
+		}
+		return ipnet.IP.String()
+	}
+	return "none"
+}
@@ -2,152 +2,84 @@ package main
 
 import (
 	"time"
-	"unicode"
-	"unicode/utf8"
 
-	"code.sztanpet.net/zvpsz/barcode-scanner/internal/tty"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/wifi"
 )
 
-var WiFiAcc = wifi.Account{}
+// wifiResultDurr is how long the result of the wifi setup stays on the screen
+var wifiResultDurr = 2 * time.Second
 
-// enterWifiSetup is only called by transitionState
-func (a *app) enterWifiSetup() {
-	a.state = wifiSetupSSID
-	WiFiAcc.SSID = ""
-	WiFiAcc.PW = ""
-	a.currentLine.Reset()
-
-	a.screen.Clear()
-	a.screen.WriteTitle("WI-FI SETUP")
-	a.screen.WriteLine(1, "SSID:")
-	a.screen.WriteLine(2, "")
-	a.screen.WriteHelp("(ESC to cancel)")
-}
-func (a *app) enterWifiSetupPW() {
-	a.state = wifiSetupPW
-	a.currentLine.Reset()
-
-	a.screen.Clear()
-	a.screen.WriteTitle("WI-FI SETUP")
-	a.screen.WriteLine(1, "Password:")
-	a.screen.WriteLine(2, "")
-	a.screen.WriteHelp("(ESC to cancel)")
+// wifiSetupView asks for the SSID, then the password and then tries the account
+func (a *app) wifiSetupView() *view {
+	return a.textInputView("wifiSetupSSID", "WI-FI SETUP", "SSID:", func(ssid string) {
+		a.replace(a.textInputView("wifiSetupPW", "WI-FI SETUP", "Password:", func(pw string) {
+			a.replace(a.wifiSetupDoneView(wifi.Account{SSID: ssid, PW: pw}))
+		}))
+	})
 }
-func (a *app) enterWifiSetupDone() {
-	a.state = wifiSetupDone
-	a.currentLine.Reset()
-
-	a.screen.Clear()
-	a.screen.WriteTitle("WI-FI SETUP")
-	a.screen.WriteLine(1, "Checking…")
-	a.screen.WriteLine(2, "Please wait…")
-	a.screen.WriteHelp("")
 
-	err := wifi.StoreAndTry(a.ctx, a.cfg, WiFiAcc)
-	if err != nil {
-		a.screen.WriteLine(2, "Error!")
-		logger.Criticalf("wifi setup error: %v", err)
-	} else {
-		a.screen.WriteLine(2, "Success!")
+// wifiSetupDoneView stores and tries the account in the background while showing the progress,
+// then returns to readBarcode, the input is ignored in the meantime, scans get the busy feedback
+func (a *app) wifiSetupDoneView(acc wifi.Account) *view {
+	v := &view{
+		name: "wifiSetupDone",
+		keys: map[rune]func(){
+			'\n': a.busyFeedback,
+		},
+		// the scans are turned down until the setup is over
+		scans: true,
 	}
-	time.Sleep(2 * time.Second)
-	a.doneWifiSetup()
-}
-
-func (a *app) enterWifiPrint() {
-	a.state = wifiPrint
-	a.currentLine.Reset()
-
-	a.screen.Clear()
-	a.screen.WriteTitle("WI-FI INFO")
-	a.screen.WriteHelp("(any key to return)")
-
-	acc, err := wifi.LoadAccount(a.cfg)
-	if err != nil {
-		a.screen.WriteLine(1, "Error loading info")
-		a.screen.WriteLine(2, err.Error())
-		return
-	}
-
-	a.screen.WriteLine(1, "SSID: "+acc.SSID)
-	a.screen.WriteLine(2, "PW: "+acc.PW)
-}
-
-// cancelWifiSetup is only called by transitionState
-func (a *app) cancelWifiSetup() {
-	a.state = readBarcode
-	WiFiAcc.SSID = ""
-	WiFiAcc.PW = ""
-	a.currentLine.Reset()
-	a.enterReadBarcode()
-}
-
-func (a *app) doneWifiSetup() {
-	logger.Debugf("handleWifiSetupInput: doneWifiSetup -> readBarcode")
-	a.cancelWifiSetup()
-}
-
-// handleWifiSetupInput is only called by transitionState
-func (a *app) handleWifiSetupInput(r rune) {
-	switch r {
-	case '\n':
-		line := a.currentLine.String()
-		switch a.state {
-		case wifiSetupSSID:
-			WiFiAcc.SSID = line
-			if len(line) > 0 {
-				a.enterWifiSetupPW()
-			}
-
-		case wifiSetupPW:
-			WiFiAcc.PW = line
-			if len(line) > 0 {
-				a.enterWifiSetupDone()
+	// the steps and the result are only shown while the view is still on the top
+	show := func(f func()) {
+		a.do(func() {
+			if a.top() == v {
+				f()
 			}
+		})
+	}
 
-		case wifiSetupDone:
-			// nothing to do
-		case wifiPrint:
-			a.cancelWifiSetup()
-		default:
-			panic("unhandled state " + string(rune(a.state+'0')))
-		}
-
-	case tty.KeyEscape:
-		logger.Debugf("handleWifiSetupInput: escape pressed; state was: %v", a.state)
-		a.cancelWifiSetup()
-
-	case tty.KeyBackspace, tty.KeyDelete:
-		if a.state == wifiPrint {
-			a.cancelWifiSetup()
-			return
-		}
-		// https://stackoverflow.com/questions/39907667/how-to-remove-unicode-characters-from-byte-buffer-in-go
-		if a.currentLine.Len() >= 1 {
-			b := a.currentLine.Bytes()
-			i := 0
-			for i < len(b) {
-				_, n := utf8.DecodeRune(b[i:])
-				if i+n == len(b) {
-					a.currentLine.Truncate(i)
-					break
+	v.enter = func() {
+		a.screen.Clear()
+		a.screen.WriteTitle("WI-FI SETUP")
+		a.screen.WriteLine(1, "Checking…")
+		a.screen.WriteLine(2, "Please wait…")
+		a.screen.WriteHelp("")
+
+		go func() {
+			err := a.storeAndTry(a.ctx, a.cfg, acc, func(step string) {
+				show(func() {
+					a.screen.WriteLine(2, step)
+				})
+			})
+
+			show(func() {
+				if err != nil {
+					a.screen.WriteWrapped(1, "Error! "+err.Error())
+					logger.Criticalf("wifi setup error: %v", err)
+				} else {
+					a.screen.WriteLine(2, "Success!")
 				}
-				i += n
-			}
+				a.statusTick()
+			})
+
+			// wait so user can read it
+			time.Sleep(wifiResultDurr)
+			show(func() {
+				logger.Debugf("wifiSetupDone -> readBarcode")
+				a.home()
+			})
+		}()
+	}
+	return v
+}
 
-			a.screen.WriteLine(2, a.currentLine.String())
-			logger.Tracef("handleWifiSetupInput: backspace")
-		}
-	default:
-		if a.state == wifiPrint {
-			a.cancelWifiSetup()
-			return
+func (a *app) wifiPrintView() *view {
+	return a.infoView("wifiPrint", "WI-FI INFO", func() []string {
+		acc, err := wifi.LoadAccount(a.cfg)
+		if err != nil {
+			return []string{"Error loading info", err.Error()}
 		}
 
-		if unicode.IsPrint(r) {
-			_, _ = a.currentLine.WriteRune(r)
-			a.screen.WriteLine(2, a.currentLine.String())
-		}
-	}
+		return []string{"SSID: " + acc.SSID, "PW: " + acc.PW}
+	})
 }
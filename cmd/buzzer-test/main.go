@@ -1,30 +1,60 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"os"
 	"time"
 
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/buzzer"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/feedback"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
+)
+
+var (
+	tones = flag.String("tones", "", "tones to play once, see pattern.ParseTones, ex: c6:80ms e6:80ms g6:160ms@50")
+	name  = flag.String("pattern", "", "feedback pattern to play once, ex: success")
+	chip  = flag.Int("chip", 0, "the number of the pwm chip")
+	pwm   = flag.Int("channel", 0, "the number of the pwm of the chip")
 )
 
 func main() {
+	flag.Parse()
+
 	// http://blog.oddbit.com/post/2017-09-26-some-notes-on-pwm-on-the-raspberry-pi/
 	// echo 0 > /sys/class/pwm/pwmchip0/export
 	// 2068hz
 	// echo 241779 > /sys/class/pwm/pwmchip0/pwm0/duty_cycle
 	// echo 483558 > /sys/class/pwm/pwmchip0/pwm0/period
 	// 150ms on
-	err := buzzer.Setup()
+	err := buzzer.Setup(&buzzer.Opts{Chip: *chip, Channel: *pwm})
 	if err != nil {
 		fmt.Printf("err: %v\n", err)
 	}
+
+	ctx := context.Background()
+	if *tones != "" || *name != "" {
+		t := feedback.Patterns[*name].Tones
+		if *tones != "" {
+			if t, err = pattern.ParseTones(*tones); err != nil {
+				fmt.Printf("tones err: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err = buzzer.Play(ctx, t); err != nil {
+			fmt.Printf("beep err: %v\n", err)
+		}
+		return
+	}
+
 	for {
-		err = buzzer.SuccessBeep()
+		err = buzzer.Play(ctx, feedback.Patterns["success"].Tones)
 		if err != nil {
 			fmt.Printf("beep err: %v", err)
 		}
 		<-time.After(1500 * time.Millisecond)
-		err = buzzer.FailBeep()
+		err = buzzer.Play(ctx, feedback.Patterns["fail"].Tones)
 		if err != nil {
 			fmt.Printf("beep err: %v", err)
 		}
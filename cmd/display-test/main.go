@@ -2,27 +2,71 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"strings"
 	"time"
 
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/display"
 )
 
+var virtual = flag.Bool("virtual", false, "render into memory and print the frame to the terminal instead of using the display")
+var driver = flag.String("driver", "", "the display driver to use, one of: "+strings.Join(display.Drivers(), ", "))
+var pngPath = flag.String("png", "", "write the rendered frame as a PNG to this path")
+
+// the golden-image comparison of the layouts is internal/display.TestRender
 func main() {
-	// TODO burn-in!
+	flag.Parse()
+
 	// TODO led
-	s, err := display.NewScreen(context.Background())
-	if err != nil {
-		fmt.Printf("error: %v\n", err)
-		return
+	var s *display.Screen
+	var v *display.Virtual
+	if *virtual {
+		v = display.NewVirtual()
+		s = display.NewScreenWithDevice(context.Background(), v)
+	} else {
+		var err error
+		opts := display.DefaultOpts
+		if *driver != "" {
+			opts.Driver = *driver
+		}
+		s, err = display.NewScreen(context.Background(), &opts)
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			return
+		}
 	}
 
 	defer s.Blank()
 
-	s.WriteTitle("WIFI SETUP")
-	s.WriteLine(1, "SSID:")
-	s.WriteLine(2, "fooBarŰÁÉÚŐÍÓÜÖ")
-	s.WriteHelp("(enter when done)")
+	writeLayout(s, [4]string{"WIFI SETUP", "SSID:", "fooBarŰÁÉÚŐÍÓÜÖ", "(enter when done)"})
+
+	if v != nil {
+		fmt.Print(v.String())
+	}
+
+	if *pngPath != "" {
+		data, err := s.Snapshot()
+		if err != nil {
+			fmt.Printf("snapshot error: %v\n", err)
+			return
+		}
+		if err := ioutil.WriteFile(*pngPath, data, 0644); err != nil {
+			fmt.Printf("write error: %v\n", err)
+			return
+		}
+	}
+
+	if v == nil {
+		time.Sleep(5 * time.Second)
+	}
+}
 
-	time.Sleep(5 * time.Second)
+func writeLayout(s *display.Screen, l [4]string) {
+	s.Clear()
+	s.WriteTitle(l[0])
+	s.WriteLine(1, l[1])
+	s.WriteLine(2, l[2])
+	s.WriteHelp(l[3])
 }
@@ -10,6 +10,7 @@ import (
 
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/file"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/gpio"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/hardware"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/update"
 )
 
@@ -25,7 +26,12 @@ func (a *app) handleSignals() {
 
 func (a *app) handleLED(binaries []string) {
 	// only applicable for hardware with status leds
-	if a.cfg.HardwareVersion < 2 {
+	hw, err := hardware.Load(a.cfg.HardwareProfile)
+	if err != nil {
+		logger.Criticalf("hardware.Load failed: %v", err)
+		return
+	}
+	if hw.GPIO == nil {
 		return
 	}
 
@@ -36,7 +42,8 @@ func (a *app) handleLED(binaries []string) {
 			continue
 		}
 
-		if err := gpio.Setup(); err != nil {
+		opts := hw.GPIOOpts(a.cfg)
+		if err := gpio.Setup(&opts); err != nil {
 			logger.Criticalf("gpio.Setup failed: %v", err)
 			return
 		}
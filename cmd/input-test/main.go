@@ -2,15 +2,31 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/evdev"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/input"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/serial"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/tty"
 )
 
+var (
+	driver  = flag.String("driver", "tty", "input driver: tty, evdev or serial")
+	device  = flag.String("device", "", "evdev: usb <vendor>:<product> id of the scanner, ex: 0c2e:0b61, or its /dev/input path")
+	layout  = flag.String("layout", "us", "evdev, tty: keyboard layout of the scanner")
+	console = flag.String("console", "us", "tty: keyboard layout of the console")
+	port    = flag.String("port", serial.DefaultOpts.Path, "serial: path of the port")
+	baud    = flag.Int("baud", serial.DefaultOpts.Baud, "serial: baud rate")
+)
+
 func main() {
+	flag.Parse()
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c)
 	go func(c chan os.Signal) {
@@ -19,11 +35,11 @@ func main() {
 	}(c)
 
 	ctx, cancel := context.WithCancel(context.Background())
-	t, err := tty.Open(ctx)
+	t, err := open(ctx)
 	if err != nil {
 		log.Fatalf("input err: %v", err)
 	}
-	defer t.RestoreTermMode()
+	defer t.Close()
 
 	for {
 		r, _, err := t.ReadRune()
@@ -40,3 +56,40 @@ func main() {
 		}
 	}
 }
+
+func open(ctx context.Context) (input.Source, error) {
+	switch *driver {
+	case "tty":
+		t, err := tty.Open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c, ok := tty.Layouts[*console]
+		l, ok2 := tty.Layouts[*layout]
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("unknown layout, supported: %v", tty.LayoutNames())
+		}
+		t.Remap(c, l)
+		return t, nil
+	case "evdev":
+		var path string
+		var vendor, product uint16
+		if strings.HasPrefix(*device, "/dev/input/") {
+			path = *device
+		} else if _, err := fmt.Sscanf(*device, "%x:%x", &vendor, &product); err != nil {
+			return nil, fmt.Errorf("invalid -device: %v", err)
+		}
+		l, ok := tty.Layouts[*layout]
+		if !ok {
+			return nil, fmt.Errorf("unknown layout, supported: %v", tty.LayoutNames())
+		}
+		return evdev.Open(ctx, path, vendor, product, l)
+	case "serial":
+		opts := serial.DefaultOpts
+		opts.Path = *port
+		opts.Baud = *baud
+		return serial.Open(ctx, opts)
+	}
+
+	return nil, fmt.Errorf("unknown driver: %v", *driver)
+}
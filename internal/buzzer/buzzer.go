@@ -5,25 +5,42 @@
 package buzzer
 
 import (
+	"context"
 	"io"
 	"os"
+	"strconv"
 	"sync"
 	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
 )
 
-const pwmBase = "/sys/class/pwm/pwmchip0"
-const port = "/pwm0"
-const beepDurr = 150 * time.Millisecond
+// pwmBase, port and channel are the pwm chip and channel of the buzzer, see Setup
+var pwmBase = "/sys/class/pwm/pwmchip0"
+var port = "/pwm0"
+var channel = "0"
+
+// defaultPeriod is 2068Hz in ns, the resonant frequency of the piezo
+const defaultPeriod = 483558
 
 var exported bool
+
+// period and duty are the current settings of the pwm in ns
+var period, duty int64
 var lastBeep time.Time
+
+// running guards the pwm against the idle check, feedback.Player plays one pattern at a time
 var running sync.Mutex
 var once sync.Once
 
-func Setup() (err error) {
+func Setup(opts *Opts) (err error) {
 	running.Lock()
 	defer running.Unlock()
 
+	pwmBase = "/sys/class/pwm/pwmchip" + strconv.Itoa(opts.Chip)
+	channel = strconv.Itoa(opts.Channel)
+	port = "/pwm" + channel
+
 	once.Do(func() {
 		go checkLastBeep()
 	})
@@ -36,8 +53,8 @@ func Setup() (err error) {
 	return
 }
 
-// TODO something two-tone, need to refactor this shit for that, maybe one day
-func StartupBeep() (err error) {
+// Play plays the tones one after the other, it stops early when ctx is done
+func Play(ctx context.Context, tones []pattern.Tone) (err error) {
 	running.Lock()
 	defer running.Unlock()
 	defer markLastBeep()
@@ -47,46 +64,50 @@ func StartupBeep() (err error) {
 		return err
 	}
 
-	enable()
-	<-time.After(beepDurr / 3)
-	disable()
+	for _, t := range tones {
+		if t.Freq > 0 {
+			if err = setTone(t.Freq, t.Volume); err != nil {
+				return err
+			}
+			enable()
+		} else {
+			disable()
+		}
+		if err = pattern.Sleep(ctx, t.Durr); err != nil {
+			return err
+		}
+	}
 	return
 }
 
-func SuccessBeep() (err error) {
-	running.Lock()
-	defer running.Unlock()
-	defer markLastBeep()
-	defer disable()
+// setTone sets the period and the duty cycle of the pwm for the frequency,
+// the piezo is the loudest at 50% duty cycle, the volume scales it down
+func setTone(freq, volume int) error {
+	if volume <= 0 || volume > 100 {
+		volume = 100
+	}
+	p := int64(time.Second) / int64(freq)
+	d := p / 2 * int64(volume) / 100
+	if p == period && d == duty {
+		return nil
+	}
 
-	if err = ensureExported(); err != nil {
+	// the duty cycle can never be longer than the period, so it is zeroed first
+	if err := write(pwmBase+port+"/duty_cycle", "0"); err != nil {
+		unexport()
 		return err
 	}
-
-	enable()
-	<-time.After(beepDurr)
-	disable()
-	return
-}
-
-func FailBeep() (err error) {
-	running.Lock()
-	defer running.Unlock()
-	defer markLastBeep()
-	defer disable()
-
-	if err = ensureExported(); err != nil {
+	if err := write(pwmBase+port+"/period", strconv.FormatInt(p, 10)); err != nil {
+		unexport()
 		return err
 	}
-
-	for i := 0; i < 4; i++ {
-		enable()
-		<-time.After(beepDurr / 2)
-		disable()
-		<-time.After(beepDurr / 2)
+	if err := write(pwmBase+port+"/duty_cycle", strconv.FormatInt(d, 10)); err != nil {
+		unexport()
+		return err
 	}
 
-	return
+	period, duty = p, d
+	return nil
 }
 
 func markLastBeep() {
@@ -151,22 +172,29 @@ func ensureExported() error {
 	}
 
 	if !exported {
-		err := write(pwmBase+"/export", "0")
+		err := write(pwmBase+"/export", channel)
 		if err != nil {
 			return err
 		}
 		exported = true
 	}
 
-	err := write(pwmBase+port+"/period", "483558")
+	// the duty cycle is zeroed first, it can never be longer than the period
+	err := write(pwmBase+port+"/duty_cycle", "0")
+	if err != nil {
+		return err
+	}
+
+	err = write(pwmBase+port+"/period", strconv.FormatInt(defaultPeriod, 10))
 	if err != nil {
 		return err
 	}
 
-	err = write(pwmBase+port+"/duty_cycle", "241779")
+	err = write(pwmBase+port+"/duty_cycle", strconv.FormatInt(defaultPeriod/2, 10))
 	if err != nil {
 		return err
 	}
+	period, duty = defaultPeriod, defaultPeriod/2
 
 	err = write(pwmBase+port+"/polarity", "normal")
 	if err != nil {
@@ -178,7 +206,7 @@ func ensureExported() error {
 }
 
 func unexport() {
-	_ = write(pwmBase+"/unexport", "0")
+	_ = write(pwmBase+"/unexport", channel)
 	exported = false
 }
 
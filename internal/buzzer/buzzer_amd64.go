@@ -5,31 +5,20 @@
 package buzzer
 
 import (
-	"time"
-)
+	"context"
 
-const beepDurr = 150 * time.Millisecond
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
+)
 
-func Setup() error {
+func Setup(opts *Opts) error {
 	return nil
 }
 
-// TODO something two-tone, need to refactor this shit for that, maybe one day
-func StartupBeep() (err error) {
-	<-time.After(beepDurr / 3)
-	return
-}
-
-func SuccessBeep() (err error) {
-	<-time.After(beepDurr)
-	return
-}
-
-func FailBeep() (err error) {
-	for i := 0; i < 4; i++ {
-		<-time.After(beepDurr / 2)
-		<-time.After(beepDurr / 2)
+func Play(ctx context.Context, tones []pattern.Tone) error {
+	for _, t := range tones {
+		if err := pattern.Sleep(ctx, t.Durr); err != nil {
+			return err
+		}
 	}
-
-	return
+	return nil
 }
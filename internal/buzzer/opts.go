@@ -0,0 +1,9 @@
+package buzzer
+
+// Opts select the pwm the buzzer is on
+type Opts struct {
+	// Chip is the number of the pwm chip, ex: 0 for /sys/class/pwm/pwmchip0
+	Chip int
+	// Channel is the number of the pwm of the chip, ex: 0 for pwm0
+	Channel int
+}
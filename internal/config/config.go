@@ -2,14 +2,21 @@ package config
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/gpio"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
 	"github.com/juju/loggo"
 )
 
 var logger = loggo.GetLogger("main.config")
+var bindingRe = regexp.MustCompile(`(?i)^(INGRESS|EGRESS)-\d+$`)
 
 type Config struct {
 	StatePath         string
@@ -18,7 +25,94 @@ type Config struct {
 	TelegramToken     string
 	TelegramChannelID int64
 	MachineID         string
-	HardwareVersion   int64
+	// built-in hardware profile name or json file, see hardware.Load
+	HardwareProfile string
+
+	// feedback driver selection, see feedback.Drivers, empty means the one of the hardware version
+	FeedbackDriver string
+	// tones replacing the built-in ones by pattern name, see pattern.ParseTones
+	FeedbackTones map[string][]pattern.Tone
+
+	// gpio only, see gpio.Opts, empty values mean the defaults
+	GPIOBackend string
+	GPIOChip    string
+	// the pins replacing the ones of the hardware profile by name, see ParsePins
+	GPIOPins map[string]gpio.Pin
+	// the push buttons added to the ones of the hardware profile by name, see ParsePins
+	GPIOButtons map[string]gpio.Pin
+	// the actions of the button presses, see ParseButtonActions
+	ButtonActions map[string]string
+	// how long a button has to be held for a long press, zero means the default
+	ButtonLongPress time.Duration
+
+	// power supply selection, see power.Drivers, empty values mean the ones of the hardware profile
+	PowerDriver  string
+	PowerBus     string
+	PowerAddress uint16
+	// how long the device runs on battery before powering off, zero means the default
+	PowerLossGrace time.Duration
+	// the battery percentage under which the device powers off right away
+	PowerOffBattery int
+
+	// display driver selection, see display.Drivers, empty values mean the defaults
+	DisplayDriver   string
+	DisplayBus      string
+	DisplayAddress  uint16
+	DisplayDCPin    string
+	DisplayRotated  bool
+	DisplayContrast uint8
+	DisplayCols     int
+	DisplayRows     int
+
+	// the curriers the picker offers, in the configured order
+	Curriers []Currier
+	// json file with the curriers, see currier.Currier, takes precedence over Curriers
+	CurriersFile string
+
+	// the devices the barcodes are read from, there is always at least one
+	Inputs []Input
+	// the keyboard layout the scanners are configured to, see tty.Layouts
+	KeyboardLayout string
+	// tty only, the keyboard layout of the console, the runes are remapped if it differs
+	ConsoleLayout string
+
+	// lines slower than these are typed by hand, see input.Timing, zero means the default
+	ScanMaxGap    time.Duration
+	ScanMaxAvgGap time.Duration
+	// what happens to typed lines: confirm, reject or accept
+	ManualEntry string
+
+	// serial only, see serial.Opts, empty values mean the defaults
+	SerialPath       string
+	SerialBaud       int
+	SerialFraming    string
+	SerialTerminator string
+	SerialPrefix     string
+	SerialSuffix     string
+	// serial only, commands sent to the scanner after a scan, empty means no command
+	SerialSuccessCmd string
+	SerialFailCmd    string
+}
+
+// Input is a device the barcodes are read from
+type Input struct {
+	ID string
+	// Driver is tty, evdev or serial
+	Driver string
+	// evdev only, the usb vendor and product id of the scanner, unless Path is set
+	Vendor, Product uint16
+	// serial: the path of the port, empty means SerialPath,
+	// evdev: the device, ex: /dev/input/by-id/..., tells identical scanners apart
+	Path string
+	// Binding is the <DIRECTION>-<currier> the scans of the input are stored with,
+	// empty means the one picked on the screen
+	Binding string
+}
+
+// Currier is a currier service number with the name shown to the operator
+type Currier struct {
+	ID   string
+	Name string
 }
 
 func Get() *Config {
@@ -58,17 +152,140 @@ func Get() *Config {
 		os.Exit(1)
 	}
 
-	hwv := os.Getenv("HARDWARE_VERSION")
-	if hwv == "" {
-		hwv = "1"
+	// the profile of the hardware version unless configured
+	HardwareProfile := os.Getenv("HARDWARE_PROFILE")
+	if HardwareProfile == "" {
+		hwv := os.Getenv("HARDWARE_VERSION")
+		if hwv == "" {
+			hwv = "1"
+		}
+		if _, err := strconv.ParseInt(hwv, 10, 64); err != nil {
+			logger.Criticalf("Failed parsing HARDWARE_VERSION env var!")
+			os.Exit(1)
+		}
+		HardwareProfile = "v" + hwv
+	}
+
+	DisplayAddress, err := strconv.ParseUint(os.Getenv("DISPLAY_ADDRESS"), 0, 16)
+	if err != nil && os.Getenv("DISPLAY_ADDRESS") != "" {
+		logger.Criticalf("Failed parsing DISPLAY_ADDRESS env var!")
+		os.Exit(1)
+	}
+
+	DisplayRotated := os.Getenv("DISPLAY_ROTATED") == "1" || os.Getenv("DISPLAY_ROTATED") == "true"
+
+	contrast := os.Getenv("DISPLAY_CONTRAST")
+	if contrast == "" {
+		contrast = "255"
+	}
+	DisplayContrast, err := strconv.ParseUint(contrast, 0, 8)
+	if err != nil {
+		logger.Criticalf("Failed parsing DISPLAY_CONTRAST env var!")
+		os.Exit(1)
+	}
+
+	// character displays only, in the form of <cols>x<rows>, ex: 20x4
+	var DisplayCols, DisplayRows int
+	if size := os.Getenv("DISPLAY_SIZE"); size != "" {
+		if _, err := fmt.Sscanf(size, "%dx%d", &DisplayCols, &DisplayRows); err != nil {
+			logger.Criticalf("Failed parsing DISPLAY_SIZE env var!")
+			os.Exit(1)
+		}
+	}
+
+	Curriers, err := ParseCurriers(os.Getenv("CURRIERS"))
+	if err != nil {
+		logger.Criticalf("Failed parsing CURRIERS env var!")
+		os.Exit(1)
+	}
+
+	Inputs, err := ParseInputs(os.Getenv("INPUTS"))
+	if err != nil {
+		logger.Criticalf("Failed parsing INPUTS env var: %v", err)
+		os.Exit(1)
+	}
+	if len(Inputs) == 0 {
+		driver := os.Getenv("INPUT_DRIVER")
+		if driver == "" {
+			driver = "tty"
+		}
+
+		in := driver + " " + os.Getenv("INPUT_DEVICE")
+		if Inputs, err = ParseInputs("main " + in); err != nil {
+			logger.Criticalf("Failed parsing INPUT_DRIVER or INPUT_DEVICE env var: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	KeyboardLayout := os.Getenv("KEYBOARD_LAYOUT")
+	if KeyboardLayout == "" {
+		KeyboardLayout = "us"
+	}
+
+	ScanMaxGap := duration("SCAN_MAX_GAP")
+	ScanMaxAvgGap := duration("SCAN_MAX_AVG_GAP")
+
+	ManualEntry := os.Getenv("MANUAL_ENTRY")
+	switch ManualEntry {
+	case "":
+		ManualEntry = "confirm"
+	case "confirm", "reject", "accept":
+	default:
+		logger.Criticalf("Invalid MANUAL_ENTRY env var, expected confirm, reject or accept!")
+		os.Exit(1)
+	}
+
+	ConsoleLayout := os.Getenv("CONSOLE_LAYOUT")
+	if ConsoleLayout == "" {
+		ConsoleLayout = "us"
+	}
+
+	FeedbackTones, err := ParseTones(os.Getenv("FEEDBACK_TONES"))
+	if err != nil {
+		logger.Criticalf("Failed parsing FEEDBACK_TONES env var: %v", err)
+		os.Exit(1)
+	}
+
+	GPIOPins, err := ParsePins(os.Getenv("GPIO_PINS"))
+	if err != nil {
+		logger.Criticalf("Failed parsing GPIO_PINS env var: %v", err)
+		os.Exit(1)
+	}
+
+	GPIOButtons, err := ParsePins(os.Getenv("GPIO_BUTTONS"))
+	if err != nil {
+		logger.Criticalf("Failed parsing GPIO_BUTTONS env var: %v", err)
+		os.Exit(1)
 	}
 
-	HardwareVersion, err := strconv.ParseInt(hwv, 10, 64)
+	ButtonActions, err := ParseButtonActions(os.Getenv("BUTTON_ACTIONS"))
 	if err != nil {
-		logger.Criticalf("Failed parsing HARDWARE_VERSION env var!")
+		logger.Criticalf("Failed parsing BUTTON_ACTIONS env var: %v", err)
+		os.Exit(1)
+	}
+
+	PowerAddress, err := strconv.ParseUint(os.Getenv("POWER_ADDRESS"), 0, 16)
+	if err != nil && os.Getenv("POWER_ADDRESS") != "" {
+		logger.Criticalf("Failed parsing POWER_ADDRESS env var!")
 		os.Exit(1)
 	}
 
+	PowerOffBattery := 10
+	if perc := os.Getenv("POWER_OFF_BATTERY"); perc != "" {
+		if PowerOffBattery, err = strconv.Atoi(perc); err != nil {
+			logger.Criticalf("Failed parsing POWER_OFF_BATTERY env var!")
+			os.Exit(1)
+		}
+	}
+
+	var SerialBaud int
+	if baud := os.Getenv("SERIAL_BAUD"); baud != "" {
+		if SerialBaud, err = strconv.Atoi(baud); err != nil {
+			logger.Criticalf("Failed parsing SERIAL_BAUD env var!")
+			os.Exit(1)
+		}
+	}
+
 	return &Config{
 		StatePath:         StatePath,
 		UpdateBaseURL:     UpdateBaseURL,
@@ -76,8 +293,210 @@ func Get() *Config {
 		TelegramToken:     TelegramToken,
 		TelegramChannelID: TelegramChannelID,
 		MachineID:         machineID(),
-		HardwareVersion:   HardwareVersion,
+		HardwareProfile:   HardwareProfile,
+		FeedbackDriver:    os.Getenv("FEEDBACK_DRIVER"),
+		FeedbackTones:     FeedbackTones,
+		GPIOBackend:       os.Getenv("GPIO_BACKEND"),
+		GPIOChip:          os.Getenv("GPIO_CHIP"),
+		GPIOPins:          GPIOPins,
+		GPIOButtons:       GPIOButtons,
+		ButtonActions:     ButtonActions,
+		ButtonLongPress:   duration("BUTTON_LONG_PRESS"),
+		PowerDriver:       os.Getenv("POWER_DRIVER"),
+		PowerBus:          os.Getenv("POWER_BUS"),
+		PowerAddress:      uint16(PowerAddress),
+		PowerLossGrace:    duration("POWER_LOSS_GRACE"),
+		PowerOffBattery:   PowerOffBattery,
+		DisplayDriver:     os.Getenv("DISPLAY_DRIVER"),
+		DisplayBus:        os.Getenv("DISPLAY_BUS"),
+		DisplayAddress:    uint16(DisplayAddress),
+		DisplayDCPin:      os.Getenv("DISPLAY_DC_PIN"),
+		DisplayRotated:    DisplayRotated,
+		DisplayContrast:   uint8(DisplayContrast),
+		DisplayCols:       DisplayCols,
+		DisplayRows:       DisplayRows,
+		Curriers:          Curriers,
+		CurriersFile:      os.Getenv("CURRIERS_FILE"),
+		Inputs:            Inputs,
+		KeyboardLayout:    KeyboardLayout,
+		ConsoleLayout:     ConsoleLayout,
+		ScanMaxGap:        ScanMaxGap,
+		ScanMaxAvgGap:     ScanMaxAvgGap,
+		ManualEntry:       ManualEntry,
+		SerialPath:        os.Getenv("SERIAL_PATH"),
+		SerialBaud:        SerialBaud,
+		SerialFraming:     os.Getenv("SERIAL_FRAMING"),
+		SerialTerminator:  unescape("SERIAL_TERMINATOR"),
+		SerialPrefix:      unescape("SERIAL_PREFIX"),
+		SerialSuffix:      unescape("SERIAL_SUFFIX"),
+		SerialSuccessCmd:  unescape("SERIAL_SUCCESS_CMD"),
+		SerialFailCmd:     unescape("SERIAL_FAIL_CMD"),
+	}
+}
+
+// unescape returns the env var with the go escapes interpreted, ex: \r\n or \x16
+func unescape(name string) string {
+	v, err := strconv.Unquote(`"` + os.Getenv(name) + `"`)
+	if err != nil {
+		logger.Criticalf("Failed parsing %v env var!", name)
+		os.Exit(1)
+	}
+	return v
+}
+
+// duration returns the env var parsed as a duration, ex: 80ms, zero if empty
+func duration(name string) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		logger.Criticalf("Failed parsing %v env var!", name)
+		os.Exit(1)
 	}
+	return d
+}
+
+// ParseCurriers parses a comma separated list of <number>=<name>, ex: 3=GLS,5=DPD
+func ParseCurriers(list string) ([]Currier, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var ret []Currier
+	for _, item := range strings.Split(list, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		id := strings.TrimSpace(kv[0])
+		if _, err := strconv.Atoi(id); err != nil || len(kv) != 2 {
+			return nil, fmt.Errorf("invalid currier: %q", item)
+		}
+		ret = append(ret, Currier{ID: id, Name: strings.TrimSpace(kv[1])})
+	}
+	return ret, nil
+}
+
+// ParseTones parses a semicolon separated list of <pattern>=<tones>,
+// ex: success=c7:100ms; fail=a4:300ms r:50ms a4:300ms
+func ParseTones(list string) (map[string][]pattern.Tone, error) {
+	ret := map[string][]pattern.Tone{}
+	for _, item := range strings.Split(list, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid tones: %q", item)
+		}
+		tones, err := pattern.ParseTones(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		ret[strings.TrimSpace(kv[0])] = tones
+	}
+	return ret, nil
+}
+
+// ParsePins parses a comma separated list of <name>=<pin>, see gpio.ParsePin,
+// ex: beeper=20,red=10:low:dir
+func ParsePins(list string) (map[string]gpio.Pin, error) {
+	ret := map[string]gpio.Pin{}
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid pin: %q", item)
+		}
+		p, err := gpio.ParsePin(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		ret[strings.TrimSpace(kv[0])] = p
+	}
+	return ret, nil
+}
+
+// ParseButtonActions parses a comma separated list of <button>[:long]=<action>,
+// ex: left=direction,left:long=undo,right=wifi
+func ParseButtonActions(list string) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("invalid button action: %q", item)
+		}
+		ret[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return ret, nil
+}
+
+// ParseInputs parses a semicolon separated list of <id> <driver> [<device>] [<DIRECTION>-<currier>],
+// the device is the <vendor>:<product> id in hex for evdev and the path for serial,
+// ex: left evdev 0c2e:0b61 INGRESS-3; right serial /dev/ttyACM0 EGRESS-5
+func ParseInputs(list string) ([]Input, error) {
+	var ret []Input
+	ids := map[string]bool{}
+	for _, item := range strings.Split(list, ";") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("invalid input: %q", item)
+		}
+
+		in := Input{ID: fields[0], Driver: fields[1]}
+		if ids[in.ID] {
+			return nil, fmt.Errorf("duplicate input: %q", in.ID)
+		}
+		ids[in.ID] = true
+
+		rest := fields[2:]
+		if n := len(rest); n > 0 && bindingRe.MatchString(rest[n-1]) {
+			in.Binding = strings.ToUpper(rest[n-1])
+			rest = rest[:n-1]
+		}
+		if len(rest) > 1 {
+			return nil, fmt.Errorf("invalid input: %q", item)
+		}
+
+		switch in.Driver {
+		case "tty":
+			if len(rest) > 0 {
+				return nil, fmt.Errorf("tty takes no device: %q", item)
+			}
+		case "evdev":
+			// like lsusb shows it, ex: 0c2e:0b61, or the path of the device
+			if len(rest) == 0 {
+				return nil, fmt.Errorf("evdev needs a device: %q", item)
+			}
+			if strings.HasPrefix(rest[0], "/dev/input/") {
+				in.Path = rest[0]
+				break
+			}
+			if _, err := fmt.Sscanf(rest[0], "%x:%x", &in.Vendor, &in.Product); err != nil {
+				return nil, fmt.Errorf("invalid evdev device %q: %v", rest[0], err)
+			}
+		case "serial":
+			if len(rest) > 0 {
+				in.Path = rest[0]
+			}
+		default:
+			return nil, fmt.Errorf("unknown driver: %q", in.Driver)
+		}
+		ret = append(ret, in)
+	}
+
+	return ret, nil
 }
 
 func machineID() string {
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseInputs(t *testing.T) {
+	tests := []struct {
+		list string
+		want []Input
+		err  bool
+	}{
+		{"main tty", []Input{{ID: "main", Driver: "tty"}}, false},
+		{"a evdev 0c2e:0b61 INGRESS-3", []Input{{ID: "a", Driver: "evdev", Vendor: 0x0c2e, Product: 0x0b61, Binding: "INGRESS-3"}}, false},
+		{
+			"a evdev /dev/input/by-id/usb-scanner-1-event-kbd; b evdev /dev/input/by-path/usb-0:1.3:1.0-event-kbd egress-5",
+			[]Input{
+				{ID: "a", Driver: "evdev", Path: "/dev/input/by-id/usb-scanner-1-event-kbd"},
+				{ID: "b", Driver: "evdev", Path: "/dev/input/by-path/usb-0:1.3:1.0-event-kbd", Binding: "EGRESS-5"},
+			},
+			false,
+		},
+		{"s serial /dev/ttyACM0", []Input{{ID: "s", Driver: "serial", Path: "/dev/ttyACM0"}}, false},
+		{"a evdev", nil, true},
+		{"a evdev scanner", nil, true},
+		{"a tty /dev/tty1", nil, true},
+		{"a tty; a tty", nil, true},
+		{"a usb", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseInputs(tt.list)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseInputs(%q) error: %v", tt.list, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseInputs(%q) = %+v, expected %+v", tt.list, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package currier
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/config"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/file"
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("main.currier")
+
+// Currier is a currier service the barcodes are scanned for
+type Currier struct {
+	ID   string
+	Name string
+	// Pattern is an optional regexp the barcodes of the currier match
+	Pattern string
+	// Active curriers are offered by the picker, inactive ones are only kept for their names
+	Active bool
+}
+
+// Source loads the list of curriers, ex: from the database
+type Source func(ctx context.Context) ([]Currier, error)
+
+// Registry holds the known curriers, a copy is cached under STATE_PATH
+// so the names are known even when the source is unreachable
+type Registry struct {
+	path string
+	// static is true when the curriers come from the config, those are never synced
+	static bool
+
+	mu       sync.RWMutex
+	curriers []Currier
+	patterns map[string]*regexp.Regexp
+}
+
+// New returns a Registry loaded from the config file or the config if set,
+// otherwise from the cache, waiting to be synced
+func New(cfg *config.Config) *Registry {
+	r := &Registry{
+		path: filepath.Join(cfg.StatePath, "curriers"),
+	}
+
+	switch {
+	case cfg.CurriersFile != "":
+		list, err := loadFile(cfg.CurriersFile)
+		if err != nil {
+			logger.Errorf("failed loading curriers from %v: %v", cfg.CurriersFile, err)
+			break
+		}
+		r.static = true
+		r.set(list)
+		return r
+
+	case len(cfg.Curriers) > 0:
+		list := make([]Currier, 0, len(cfg.Curriers))
+		for _, c := range cfg.Curriers {
+			list = append(list, Currier{ID: c.ID, Name: c.Name, Active: true})
+		}
+		r.static = true
+		r.set(list)
+		return r
+	}
+
+	if file.Exists(r.path) {
+		var list []Currier
+		if err := file.Unserialize(r.path, &list); err != nil {
+			logger.Errorf("failed loading cached curriers: %v", err)
+		}
+		r.set(list)
+	}
+
+	return r
+}
+
+// fileCurrier is a Currier in the config file, it is active unless Active is false
+type fileCurrier struct {
+	ID      string
+	Name    string
+	Pattern string
+	Active  *bool
+}
+
+// loadFile reads a JSON array of Curriers
+func loadFile(path string) ([]Currier, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []fileCurrier
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	list := make([]Currier, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, Currier{
+			ID:      e.ID,
+			Name:    e.Name,
+			Pattern: e.Pattern,
+			Active:  e.Active == nil || *e.Active,
+		})
+	}
+	return list, nil
+}
+
+// Static reports whether the curriers come from the config and should not be synced
+func (r *Registry) Static() bool {
+	return r.static
+}
+
+// Sync replaces the curriers with the ones loaded from src and caches them
+func (r *Registry) Sync(ctx context.Context, src Source) error {
+	list, err := src(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.set(list)
+	if err := file.Serialize(r.path, &list); err != nil {
+		logger.Errorf("failed caching curriers: %v", err)
+	}
+	logger.Tracef("synced %v curriers", len(list))
+	return nil
+}
+
+func (r *Registry) set(list []Currier) {
+	patterns := map[string]*regexp.Regexp{}
+	for _, c := range list {
+		if c.Pattern == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			// a broken pattern should not stop the scanning
+			logger.Errorf("invalid pattern for currier %v: %v", c.ID, err)
+			continue
+		}
+		patterns[c.ID] = re
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.curriers = list
+	r.patterns = patterns
+}
+
+// Empty reports whether no curriers are known, nothing can be validated then
+func (r *Registry) Empty() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.curriers) == 0
+}
+
+// Lookup returns the currier with the id
+func (r *Registry) Lookup(id string) (Currier, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, c := range r.curriers {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Currier{}, false
+}
+
+// Known reports whether the currier is an active one, if no curriers are known, every id is accepted
+func (r *Registry) Known(id string) bool {
+	if r.Empty() {
+		return true
+	}
+
+	c, ok := r.Lookup(id)
+	return ok && c.Active
+}
+
+// Name returns the name of the currier, or the id if it is not known
+func (r *Registry) Name(id string) string {
+	if c, ok := r.Lookup(id); ok && c.Name != "" {
+		return c.Name
+	}
+	return id
+}
+
+// Active returns the curriers that can be picked
+func (r *Registry) Active() []Currier {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ret []Currier
+	for _, c := range r.curriers {
+		if c.Active {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// Matches reports whether the barcode matches the pattern of the currier, true if it has none
+func (r *Registry) Matches(id, barcode string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	re, ok := r.patterns[id]
+	return !ok || re.MatchString(barcode)
+}
@@ -0,0 +1,107 @@
+package currier
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "currier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "curriers.json")
+	data := `[
+		{"ID": "3", "Name": "GLS", "Pattern": "^\\d{11}$"},
+		{"ID": "5", "Name": "DPD", "Active": true},
+		{"ID": "7", "Name": "TNT", "Active": false}
+	]`
+	if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		// known and unknown are the ids Known accepts and rejects
+		known   []string
+		unknown []string
+	}{
+		{
+			"env",
+			&config.Config{StatePath: dir, Curriers: []config.Currier{{ID: "3", Name: "GLS"}, {ID: "5", Name: "DPD"}}},
+			[]string{"3", "5"},
+			[]string{"7", "9"},
+		},
+		{
+			"file",
+			&config.Config{StatePath: dir, CurriersFile: file},
+			[]string{"3", "5"},
+			[]string{"7", "9"},
+		},
+	}
+
+	for _, tt := range tests {
+		r := New(tt.cfg)
+		if !r.Static() {
+			t.Errorf("%v: curriers from the config are synced", tt.name)
+		}
+		if got := len(r.Active()); got != 2 {
+			t.Errorf("%v: %v active curriers, expected 2", tt.name, got)
+		}
+		for _, id := range tt.known {
+			if !r.Known(id) {
+				t.Errorf("%v: currier %v is not known", tt.name, id)
+			}
+		}
+		for _, id := range tt.unknown {
+			if r.Known(id) {
+				t.Errorf("%v: currier %v is known", tt.name, id)
+			}
+		}
+		if got := r.Name("3"); got != "GLS" {
+			t.Errorf("%v: name of 3 is %q, expected GLS", tt.name, got)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	r := &Registry{}
+	r.set([]Currier{
+		{ID: "3", Pattern: `^\d{11}$`, Active: true},
+		{ID: "5", Active: true},
+		{ID: "7", Pattern: `(`, Active: true},
+	})
+
+	tests := []struct {
+		id, barcode string
+		want        bool
+	}{
+		{"3", "12345678901", true},
+		{"3", "1234567890", false},
+		{"3", "1Z999AA10123456784", false},
+		// no pattern or a broken one accepts everything
+		{"5", "anything", true},
+		{"7", "anything", true},
+		{"9", "anything", true},
+	}
+
+	for _, tt := range tests {
+		if got := r.Matches(tt.id, tt.barcode); got != tt.want {
+			t.Errorf("Matches(%q, %q) = %v, expected %v", tt.id, tt.barcode, got, tt.want)
+		}
+	}
+}
+
+func TestKnownEmpty(t *testing.T) {
+	r := &Registry{}
+	if !r.Known("3") {
+		t.Errorf("every currier should be known without a list")
+	}
+}
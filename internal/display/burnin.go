@@ -0,0 +1,218 @@
+package display
+
+import (
+	"image"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"periph.io/x/periph/devices/ssd1306/image1bit"
+)
+
+// OLED pixels that are lit for a long time lose brightness, the title and help bars
+// are lit all the time, so on top of blanking after ScreenTimeout:
+//  - the whole layout is moved around by a pixel every ShiftInterval
+//  - the colors are inverted every InvertInterval
+//  - the contrast is lowered after DimTimeout
+//  - a clock moving around replaces the layout after SaverTimeout
+// any activity (Wake or writing to the screen) restores the layout
+
+const burnInTick = 5 * time.Second
+const dimContrast = 0x08
+
+// shifts are the offsets the layout cycles through, at most a pixel in each direction
+var shifts = []image.Point{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+
+type inverter interface {
+	Invert(blackOnWhite bool) error
+}
+
+type waker interface {
+	Wake() error
+}
+
+// Wake restores the layout after the screen was dimmed, replaced by the screensaver or blanked
+func (s *Screen) Wake() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idle := s.dimmed || s.saver || s.blanked
+	s.markActivity()
+	if idle {
+		s.drawUnlocked()
+	}
+}
+
+func (s *Screen) burnInLoop() {
+	t := time.NewTicker(burnInTick)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-t.C:
+			s.burnInStep(now)
+		}
+	}
+}
+
+func (s *Screen) burnInStep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.blanked {
+		return
+	}
+
+	idle := now.Sub(s.lastActive)
+	if idle > ScreenTimeout {
+		if err := s.dev.Halt(); err != nil {
+			logger.Errorf("halt error: %v", err)
+			return
+		}
+		s.blanked = true
+		return
+	}
+
+	if idle > DimTimeout && !s.dimmed {
+		s.setContrastUnlocked(dimContrast)
+		s.dimmed = true
+	}
+
+	if idle > SaverTimeout {
+		s.drawSaverUnlocked(now)
+		return
+	}
+
+	redraw := false
+	if now.Sub(s.lastShift) > ShiftInterval {
+		s.shift = (s.shift + 1) % len(shifts)
+		s.lastShift = now
+		redraw = true
+	}
+	if now.Sub(s.lastInvert) > InvertInterval {
+		s.inverted = !s.inverted
+		s.lastInvert = now
+		if s.hwInvertUnlocked() {
+			if err := s.dev.(inverter).Invert(s.inverted); err != nil {
+				logger.Errorf("invert error: %v", err)
+			}
+		} else {
+			redraw = true
+		}
+	}
+
+	if redraw {
+		s.drawUnlocked()
+	}
+}
+
+// composeUnlocked returns the frame to send to the device: the image
+// moved by the current shift, and inverted if the device can not do it
+func (s *Screen) composeUnlocked() *image1bit.VerticalLSB {
+	b := s.img.Bounds()
+	ret := image1bit.NewVerticalLSB(b)
+	d := shifts[s.shift]
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p := image.Pt(x-d.X, y-d.Y)
+			if p.In(b) {
+				ret.SetBit(x, y, s.img.BitAt(p.X, p.Y))
+			}
+		}
+	}
+
+	if s.inverted && !s.hwInvertUnlocked() {
+		return invert(ret)
+	}
+	return ret
+}
+
+// drawSaverUnlocked shows the time and the title in small, the position changes every minute
+func (s *Screen) drawSaverUnlocked(now time.Time) {
+	if td, ok := s.dev.(TextDevice); ok {
+		if err := td.WriteLines([]string{now.Format("15:04"), s.lines[0]}); err != nil {
+			logger.Errorf("draw error: %v", err)
+		}
+		s.saver = true
+		return
+	}
+
+	b := s.dev.Bounds()
+	img := image1bit.NewVerticalLSB(b)
+	clock := now.Format("15:04")
+	w := font.MeasureString(titleFont, clock).Round()
+	if tw := font.MeasureString(smallFont, s.lines[0]).Round(); tw > w {
+		w = tw
+	}
+	h := titleFont.Metrics().Height.Round() + smallFont.Metrics().Height.Round()
+
+	// walk the free area in steps which are coprime to its size, so every position comes up
+	m := now.Hour()*60 + now.Minute()
+	x, y := 0, 0
+	if free := b.Dx() - w; free > 0 {
+		x = (m * 37) % free
+	}
+	if free := b.Dy() - h; free > 0 {
+		y = (m * 11) % free
+	}
+
+	d := font.Drawer{Dst: img, Src: &image.Uniform{white}, Face: titleFont}
+	d.Dot = fixed.P(x, y+titleFont.Metrics().Ascent.Round())
+	d.DrawString(clock)
+	d.Face = smallFont
+	d.Dot = fixed.P(x, y+h-smallFont.Metrics().Descent.Round())
+	d.DrawString(s.lines[0])
+
+	if s.inverted && !s.hwInvertUnlocked() {
+		img = invert(img)
+	}
+	if err := s.dev.Draw(b, img, image.Point{}); err != nil {
+		logger.Errorf("draw error: %v", err)
+	}
+	s.frame = img
+	s.saver = true
+}
+
+// wakeDeviceUnlocked turns a halted display back on, drivers skip drawing
+// an unchanged frame so the redraw alone would leave it off
+func (s *Screen) wakeDeviceUnlocked() {
+	var err error
+	if w, ok := s.dev.(waker); ok {
+		err = w.Wake()
+	} else if cs, ok := s.dev.(contraster); ok {
+		// any command re-enables the ssd1306
+		level := s.contrast
+		if s.dimmed {
+			level = dimContrast
+		}
+		err = cs.SetContrast(level)
+	}
+	if err != nil {
+		logger.Errorf("wake error: %v", err)
+	}
+}
+
+func (s *Screen) setContrastUnlocked(level byte) {
+	cs, ok := s.dev.(contraster)
+	if !ok {
+		return
+	}
+	if err := cs.SetContrast(level); err != nil {
+		logger.Errorf("set contrast error: %v", err)
+	}
+}
+
+func (s *Screen) hwInvertUnlocked() bool {
+	_, ok := s.dev.(inverter)
+	return ok
+}
+
+func invert(src *image1bit.VerticalLSB) *image1bit.VerticalLSB {
+	ret := image1bit.NewVerticalLSB(src.Bounds())
+	for i, b := range src.Pix {
+		ret.Pix[i] = ^b
+	}
+	return ret
+}
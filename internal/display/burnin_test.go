@@ -0,0 +1,83 @@
+package display
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"testing"
+
+	"periph.io/x/periph/devices/ssd1306/image1bit"
+)
+
+// recorder is a Device that behaves like the sh1106 driver: an unchanged frame
+// is not sent, so it does not switch a halted display back on
+type recorder struct {
+	last   []byte
+	halted bool
+	draws  int
+	wakes  int
+}
+
+func (r *recorder) Bounds() image.Rectangle {
+	return image.Rect(0, 0, 128, 64)
+}
+
+func (r *recorder) Draw(b image.Rectangle, src image.Image, sp image.Point) error {
+	img := image1bit.NewVerticalLSB(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			img.Set(x, y, src.At(x+sp.X, y+sp.Y))
+		}
+	}
+	if bytes.Equal(img.Pix, r.last) {
+		return nil
+	}
+	r.last = img.Pix
+	r.draws++
+	r.halted = false
+	return nil
+}
+
+func (r *recorder) Halt() error {
+	r.halted = true
+	return nil
+}
+
+func (r *recorder) Wake() error {
+	r.wakes++
+	r.halted = false
+	return nil
+}
+
+func TestWakeAfterBlank(t *testing.T) {
+	r := &recorder{}
+	s := NewScreenWithDevice(context.Background(), r)
+	s.WriteTitle("INGRESS-3")
+	s.WriteLine(1, "Barcode data:")
+
+	s.Blank()
+	if !r.halted || !s.Blanked() {
+		t.Fatalf("halted = %v, blanked = %v after Blank", r.halted, s.Blanked())
+	}
+
+	draws := r.draws
+	s.Wake()
+	if r.halted {
+		t.Errorf("display still halted after Wake")
+	}
+	if r.wakes != 1 {
+		t.Errorf("wakes = %d, want 1", r.wakes)
+	}
+	if r.draws != draws {
+		t.Errorf("unchanged frame was drawn again")
+	}
+	if s.Blanked() {
+		t.Errorf("screen still blanked after Wake")
+	}
+
+	// waking a screen that is on does not touch the display
+	s.Wake()
+	if r.wakes != 1 {
+		t.Errorf("wakes = %d after second Wake, want 1", r.wakes)
+	}
+}
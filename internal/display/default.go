@@ -0,0 +1,5 @@
+// +build !amd64
+
+package display
+
+const defaultDriver = "sh1106"
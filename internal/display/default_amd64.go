@@ -0,0 +1,6 @@
+// +build amd64
+
+package display
+
+// there is no display attached to development machines, render into memory instead
+const defaultDriver = "virtual"
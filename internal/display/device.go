@@ -0,0 +1,15 @@
+package display
+
+import (
+	"image"
+)
+
+// Device is the transport the Screen sends its frames to
+type Device interface {
+	// Bounds returns the size of the display, Min is expected to be {0, 0}
+	Bounds() image.Rectangle
+	// Draw sends the src image to the display
+	Draw(r image.Rectangle, src image.Image, sp image.Point) error
+	// Halt turns off the display, the next Draw turns it back on
+	Halt() error
+}
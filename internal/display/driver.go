@@ -0,0 +1,77 @@
+package display
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Opts selects and configures the display driver
+type Opts struct {
+	// Driver is the name of a registered driver, see Drivers
+	Driver string
+	// Bus is the periph name of the I²C or SPI bus, empty means the first one found
+	Bus string
+	// Addr is the I²C address of the display, zero means the default of the driver
+	Addr uint16
+	// DC is the name of the data/command GPIO pin of 4-wire SPI displays
+	DC string
+	// Rotated turns the image upside down
+	Rotated bool
+	// Contrast is only supported by the OLED drivers
+	Contrast byte
+	// Cols and Rows are the size of character displays
+	Cols, Rows int
+}
+
+// DefaultOpts is the sh1106 on the default I²C bus the devices were built with
+var DefaultOpts = Opts{
+	Driver:   defaultDriver,
+	Contrast: 0xFF,
+	Cols:     16,
+	Rows:     2,
+}
+
+// Driver opens a Device according to the Opts
+type Driver func(opts *Opts) (Device, error)
+
+var driversMu sync.Mutex
+var drivers = map[string]Driver{}
+
+// Register makes a driver available by name, registering the same name twice panics
+func Register(name string, d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if _, ok := drivers[name]; ok {
+		panic("display: driver registered twice: " + name)
+	}
+	drivers[name] = d
+}
+
+// Drivers returns the sorted names of the registered drivers
+func Drivers() []string {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	ret := make([]string, 0, len(drivers))
+	for name := range drivers {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func openDevice(opts *Opts) (Device, error) {
+	driversMu.Lock()
+	d, ok := drivers[opts.Driver]
+	driversMu.Unlock()
+
+	if !ok {
+		err := fmt.Errorf("unknown display driver %q, known drivers: %v", opts.Driver, Drivers())
+		logger.Criticalf("%v", err)
+		return nil, err
+	}
+
+	return d(opts)
+}
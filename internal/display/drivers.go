@@ -0,0 +1,203 @@
+package display
+
+import (
+	"fmt"
+	"image"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/hd44780"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/sh1106"
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpioreg"
+	"periph.io/x/periph/conn/i2c"
+	"periph.io/x/periph/conn/i2c/i2creg"
+	"periph.io/x/periph/conn/spi"
+	"periph.io/x/periph/conn/spi/spireg"
+	"periph.io/x/periph/devices/ssd1306"
+	"periph.io/x/periph/host"
+)
+
+func init() {
+	Register("virtual", func(*Opts) (Device, error) {
+		return NewVirtual(), nil
+	})
+	Register("sh1106", openSH1106)
+	Register("sh1106-spi", openSH1106SPI)
+	Register("ssd1306", openSSD1306)
+	Register("ssd1306-spi", openSSD1306SPI)
+	// the ssd1309 is command compatible with the ssd1306 for everything we use
+	Register("ssd1309", openSSD1306)
+	Register("ssd1309-spi", openSSD1306SPI)
+	Register("hd44780", openHD44780)
+}
+
+type contraster interface {
+	SetContrast(level byte) error
+}
+
+func openI2C(opts *Opts) (i2c.Bus, error) {
+	if _, err := host.Init(); err != nil {
+		logger.Criticalf("no display detected, skipping: %v", err)
+		return nil, err
+	}
+
+	b, err := i2creg.Open(opts.Bus)
+	if err != nil {
+		logger.Criticalf("could not open i2c bus, display disabled: %v", err)
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func openSPI(opts *Opts) (spi.Port, gpio.PinOut, error) {
+	if _, err := host.Init(); err != nil {
+		logger.Criticalf("no display detected, skipping: %v", err)
+		return nil, nil, err
+	}
+
+	p, err := spireg.Open(opts.Bus)
+	if err != nil {
+		logger.Criticalf("could not open spi port, display disabled: %v", err)
+		return nil, nil, err
+	}
+
+	// nil selects 3-wire mode in the drivers
+	var dc gpio.PinOut
+	if opts.DC != "" {
+		pin := gpioreg.ByName(opts.DC)
+		if pin == nil {
+			_ = p.Close()
+			return nil, nil, fmt.Errorf("unknown dc pin: %v", opts.DC)
+		}
+		dc = pin
+	}
+
+	return p, dc, nil
+}
+
+func setContrast(dev contraster, opts *Opts) {
+	if err := dev.SetContrast(opts.Contrast); err != nil {
+		logger.Warningf("could not set contrast: %v", err)
+	}
+}
+
+func openSH1106(opts *Opts) (Device, error) {
+	b, err := openI2C(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	o := sh1106.DefaultOpts
+	o.Rotated = opts.Rotated
+	if opts.Addr != 0 {
+		o.Addr = opts.Addr
+	}
+	dev, err := sh1106.NewI2C(b, &o)
+	if err != nil {
+		logger.Criticalf("could not find sh1106 screen, display disabled: %v", err)
+		return nil, err
+	}
+
+	setContrast(dev, opts)
+	return dev, nil
+}
+
+func openSH1106SPI(opts *Opts) (Device, error) {
+	p, dc, err := openSPI(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	o := sh1106.DefaultOpts
+	o.Rotated = opts.Rotated
+	dev, err := sh1106.NewSPI(p, dc, &o)
+	if err != nil {
+		logger.Criticalf("could not find sh1106 screen, display disabled: %v", err)
+		return nil, err
+	}
+
+	setContrast(dev, opts)
+	return dev, nil
+}
+
+// addrBus sends every transaction to addr, because ssd1306.NewI2C hardcodes 0x3C
+type addrBus struct {
+	i2c.Bus
+	addr uint16
+}
+
+func (b *addrBus) Tx(_ uint16, w, r []byte) error {
+	return b.Bus.Tx(b.addr, w, r)
+}
+
+func openSSD1306(opts *Opts) (Device, error) {
+	b, err := openI2C(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Addr != 0 {
+		b = &addrBus{Bus: b, addr: opts.Addr}
+	}
+
+	o := ssd1306.DefaultOpts
+	o.Rotated = opts.Rotated
+	dev, err := ssd1306.NewI2C(b, &o)
+	if err != nil {
+		logger.Criticalf("could not find %v screen, display disabled: %v", opts.Driver, err)
+		return nil, err
+	}
+
+	setContrast(dev, opts)
+	return dev, nil
+}
+
+func openSSD1306SPI(opts *Opts) (Device, error) {
+	p, dc, err := openSPI(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	o := ssd1306.DefaultOpts
+	o.Rotated = opts.Rotated
+	dev, err := ssd1306.NewSPI(p, dc, &o)
+	if err != nil {
+		logger.Criticalf("could not find %v screen, display disabled: %v", opts.Driver, err)
+		return nil, err
+	}
+
+	setContrast(dev, opts)
+	return dev, nil
+}
+
+// charLCD adapts the hd44780 to the Device interface, the Screen sends it
+// text through WriteLines and the frame drawn only exists for Snapshot
+type charLCD struct {
+	*hd44780.Dev
+}
+
+func (c *charLCD) Bounds() image.Rectangle {
+	return image.Rect(0, 0, 128, 64)
+}
+
+func (c *charLCD) Draw(image.Rectangle, image.Image, image.Point) error {
+	return nil
+}
+
+func openHD44780(opts *Opts) (Device, error) {
+	b, err := openI2C(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := opts.Addr
+	if addr == 0 {
+		addr = hd44780.DefaultAddr
+	}
+	dev, err := hd44780.NewI2C(b, addr, opts.Cols, opts.Rows)
+	if err != nil {
+		logger.Criticalf("could not find hd44780 lcd, display disabled: %v", err)
+		return nil, err
+	}
+
+	return &charLCD{dev}, nil
+}
@@ -0,0 +1,137 @@
+package display
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "overwrite the golden images in testdata instead of comparing")
+
+// layouts are the screens the barcode-scanner shows: title, two lines and help
+var layouts = map[string][4]string{
+	"wifi-setup":   {"WIFI SETUP", "SSID:", "fooBarŰÁÉÚŐÍÓÜÖ", "(enter when done)"},
+	"read-barcode": {"INGRESS-3", "Barcode data:", "1234567890", "waiting for scan"},
+	"wifi-info":    {"WI-FI INFO", "SSID: warehouse", "PW: hunter2", "(ENTER to return)"},
+	"long-barcode": {"EGRESS-1", "Barcode data:", "1Z999AA10123456784", "waiting for scan"},
+}
+
+// TestRender renders the layouts on a virtual display and compares them to testdata/<layout>.png,
+// run with -update to regenerate the images after an intended change
+func TestRender(t *testing.T) {
+	for name, l := range layouts {
+		l := l
+		t.Run(name, func(t *testing.T) {
+			v := NewVirtual()
+			s := NewScreenWithDevice(context.Background(), v)
+			s.Clear()
+			s.WriteTitle(l[0])
+			s.WriteLine(1, l[1])
+			s.WriteLine(2, l[2])
+			s.WriteHelp(l[3])
+
+			checkGolden(t, v, name)
+		})
+	}
+}
+
+// statusLayouts are the longest titles with the status icons, they have to stay between the icons
+var statusLayouts = map[string]struct {
+	title  string
+	status Status
+}{
+	"status-title": {"INGRESS-GLS 1234", Status{WiFi: 60, Battery: 80, Time: statusTime}},
+	"status-bound": {"dock:INGRESS-DPD", Status{WiFi: 60, Battery: 80, Time: statusTime}},
+	"status-full": {"INGRESS-GLS 1234", Status{
+		WiFi:      -1,
+		DBDown:    true,
+		Pending:   1234,
+		LowDisk:   true,
+		Battery:   8,
+		OnBattery: true,
+		Time:      statusTime,
+	}},
+}
+
+var statusTime = time.Date(2020, 1, 2, 13, 45, 0, 0, time.UTC)
+
+// TestRenderStatus renders the status layouts, the titles are drawn with smaller fonts
+// or cut instead of being covered by the icons
+func TestRenderStatus(t *testing.T) {
+	for name, l := range statusLayouts {
+		l := l
+		t.Run(name, func(t *testing.T) {
+			v := NewVirtual()
+			s := NewScreenWithDevice(context.Background(), v)
+			s.Clear()
+			s.SetStatus(l.status)
+			s.WriteTitle(l.title)
+			s.WriteLine(1, "Barcode data:")
+			s.WriteHelp("waiting for scan")
+
+			checkGolden(t, v, name)
+		})
+	}
+}
+
+func checkGolden(t *testing.T, v *Virtual, name string) {
+	t.Helper()
+
+	got, err := v.PNG()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join("testdata", name+".png")
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePixels(t, got, want) {
+		t.Errorf("the frame differs from %v, got:\n%v", path, v.String())
+	}
+}
+
+// samePixels compares the decoded images, so a different png encoder does not fail the test
+func samePixels(t *testing.T, a, b []byte) bool {
+	ia, err := png.Decode(bytes.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ib, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ia.Bounds() != ib.Bounds() {
+		return false
+	}
+
+	r := ia.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if !sameColor(ia, ib, x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func sameColor(a, b image.Image, x, y int) bool {
+	ar, ag, ab, aa := a.At(x, y).RGBA()
+	br, bg, bb, ba := b.At(x, y).RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
@@ -0,0 +1,373 @@
+package display
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/juju/loggo"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gosmallcaps"
+	"golang.org/x/image/font/inconsolata"
+	"golang.org/x/image/math/fixed"
+	"periph.io/x/periph/devices/ssd1306/image1bit"
+)
+
+var logger = loggo.GetLogger("main.display")
+
+// The ScreenTimeout duration after which the display is blanked to prevent burn-in.
+var ScreenTimeout = 90 * time.Minute
+
+// The DimTimeout duration after which the contrast is lowered
+var DimTimeout = 5 * time.Minute
+
+// The SaverTimeout duration after which the layout is replaced by a clock
+var SaverTimeout = 30 * time.Minute
+
+// The ShiftInterval between moving the whole layout by a pixel
+var ShiftInterval = 2 * time.Minute
+
+// The InvertInterval between inverting the colors of the display
+var InvertInterval = 20 * time.Minute
+
+// lineCount defines how many lines of text fit on the screen
+const lineCount = 4
+
+var mediumFont = inconsolata.Bold8x16
+var titleFont = inconsolata.Regular8x16
+var helpFont font.Face
+
+// smallFont is used when the text does not fit the line with mediumFont
+var smallFont font.Face
+
+// narrowFont is used when the title does not fit between the status icons with smallFont
+var narrowFont font.Face
+
+const white = image1bit.On
+const black = image1bit.Off
+
+// Screen handles the layout of text on the display, the pixels are sent to a Device
+type Screen struct {
+	ctx context.Context
+	dev Device
+
+	mu         sync.Mutex
+	img        *image1bit.VerticalLSB
+	lines      []string
+	lastActive time.Time
+	blanked    bool
+	marquees   map[int]*marquee
+	status     *Status
+
+	// burn-in protection state, see burnin.go
+	frame      *image1bit.VerticalLSB
+	contrast   byte
+	dimmed     bool
+	saver      bool
+	shift      int
+	inverted   bool
+	lastShift  time.Time
+	lastInvert time.Time
+}
+
+func init() {
+	// tiny help text font on the bottom
+	ff, err := truetype.Parse(gosmallcaps.TTF)
+	if err != nil {
+		panic(err.Error())
+	}
+	helpFont = truetype.NewFace(ff, &truetype.Options{
+		Size:    12,
+		Hinting: font.HintingNone,
+	})
+
+	mf, err := truetype.Parse(gomono.TTF)
+	if err != nil {
+		panic(err.Error())
+	}
+	smallFont = truetype.NewFace(mf, &truetype.Options{
+		Size:    10,
+		Hinting: font.HintingFull,
+	})
+	narrowFont = truetype.NewFace(mf, &truetype.Options{
+		Size:    8,
+		Hinting: font.HintingFull,
+	})
+}
+
+// NewScreen opens the display device selected by opts and returns a Screen using it
+func NewScreen(ctx context.Context, opts *Opts) (*Screen, error) {
+	dev, err := openDevice(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := NewScreenWithDevice(ctx, dev)
+	ret.contrast = opts.Contrast
+	return ret, nil
+}
+
+// NewScreenWithDevice returns a Screen drawing to the provided Device
+func NewScreenWithDevice(ctx context.Context, dev Device) *Screen {
+	ret := &Screen{
+		ctx:        ctx,
+		dev:        dev,
+		img:        image1bit.NewVerticalLSB(dev.Bounds()),
+		lines:      make([]string, lineCount),
+		lastActive: time.Now(),
+		marquees:   map[int]*marquee{},
+		contrast:   0xFF,
+		lastShift:  time.Now(),
+		lastInvert: time.Now(),
+	}
+	ret.Clear()
+	go ret.scrollLoop()
+	go ret.burnInLoop()
+
+	return ret
+}
+
+func (s *Screen) writeUnlocked(f font.Face, line int, c color.Color, centered bool, text string) {
+	s.writeFaceUnlocked(f, f, line, c, centered, 0, text)
+}
+
+// writeFaceUnlocked draws the text with the face f into the line as positioned by the layout face,
+// x shifts the start of the text, which is used for scrolling
+func (s *Screen) writeFaceUnlocked(layout, f font.Face, line int, c color.Color, centered bool, x int, text string) {
+	m := layout.Metrics()
+	height := s.baselineUnlocked(layout, line)
+	drawer := font.Drawer{
+		Dst:  s.img,
+		Src:  &image.Uniform{c},
+		Face: f,
+		Dot:  fixed.P(x, height),
+	}
+
+	// the expectation is that when writing an empty text, the line is cleared
+	// if the text is empty, the bounds of the string will be zero and nothing will print
+	// and the display wont change; fix this by drawing a space
+	if text == "" {
+		text = " "
+	}
+	bounds, adv := drawer.BoundString(text)
+
+	// adjust text start position
+	if centered {
+		x := s.img.Bounds().Dx()/2 - adv.Round()/2
+		drawer.Dot = fixed.P(x, height)
+	}
+
+	// if we need to write in black, the background needs to be white,
+	bg := black
+	if c == black {
+		bg = white
+	}
+
+	// add 2 pixels to the height because it looks better that way
+	top := bounds.Min.Y.Round()
+	if layout != f {
+		// a smaller face would leave the top of the previous text on the screen
+		if t := height - m.Ascent.Round(); t < top {
+			top = t
+		}
+	}
+	r := image.Rect(bounds.Min.X.Round(), top, s.img.Bounds().Dx(), height+1)
+	draw.Draw(s.img, r, &image.Uniform{bg}, image.ZP, draw.Src)
+
+	drawer.DrawString(text)
+}
+
+// baselineUnlocked returns the y coordinate of the baseline of the line as positioned by the layout face
+func (s *Screen) baselineUnlocked(layout font.Face, line int) int {
+	m := layout.Metrics()
+	height := s.img.Bounds().Dy() - m.Descent.Round()
+	// by default, 0th line is at the bottom, 3rd is at the top,
+	// invert it, because it feels better
+	// 0th line should be the top, 3rd line should be at the bottom
+	return height - (3-line)*m.Height.Round()
+}
+
+// writeFittedUnlocked draws text that does not fit the line with the smaller font,
+// if it does not fit even that way, the line starts scrolling
+func (s *Screen) writeFittedUnlocked(line int, text string) {
+	delete(s.marquees, line)
+
+	w := s.img.Bounds().Dx()
+	switch {
+	case fits(mediumFont, text, w):
+		s.writeUnlocked(mediumFont, line, white, false, text)
+	case fits(smallFont, text, w):
+		s.writeFaceUnlocked(mediumFont, smallFont, line, white, false, 0, text)
+	default:
+		s.marquees[line] = &marquee{text: text}
+		s.writeFaceUnlocked(mediumFont, smallFont, line, white, false, 0, text)
+	}
+}
+
+// WriteTitle draws the text in black on a white background into the first line (line #0)
+func (s *Screen) WriteTitle(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.markActivity()
+	s.lines[0] = text
+
+	s.writeUnlocked(titleFont, 0, black, true, text)
+	s.drawUnlocked()
+}
+
+// WriteLine writes the text in white on black into the indicated line (usually #1 or #2)
+// text too long for the line is written with a smaller font or scrolled
+func (s *Screen) WriteLine(line int, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.markActivity()
+	s.lines[line] = text
+
+	s.writeFittedUnlocked(line, text)
+	s.drawUnlocked()
+}
+
+// WriteWrapped word-wraps the text over the lines starting from the indicated line
+// up to the help line, the font is downsized when the text does not fit otherwise
+// and whatever still does not fit scrolls in the last line
+func (s *Screen) WriteWrapped(line int, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.markActivity()
+
+	avail := lineCount - 1 - line
+	if avail < 1 {
+		return
+	}
+	w := s.img.Bounds().Dx()
+	wrapped := wrap(mediumFont, text, w)
+	if len(wrapped) > avail {
+		wrapped = wrap(smallFont, text, w)
+	}
+	if len(wrapped) > avail {
+		wrapped[avail-1] = strings.Join(wrapped[avail-1:], " ")
+		wrapped = wrapped[:avail]
+	}
+
+	for i := 0; i < avail; i++ {
+		t := ""
+		if i < len(wrapped) {
+			t = wrapped[i]
+		}
+		s.lines[line+i] = t
+		s.writeFittedUnlocked(line+i, t)
+	}
+	s.drawUnlocked()
+}
+
+// WriteHelp writes help text in black on white into the last line (line #3)
+func (s *Screen) WriteHelp(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.markActivity()
+	s.lines[lineCount-1] = text
+	s.writeUnlocked(helpFont, lineCount-1, black, true, text)
+	s.drawUnlocked()
+}
+
+// Clear clears the image
+func (s *Screen) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.img = image1bit.NewVerticalLSB(s.dev.Bounds())
+	s.lines = make([]string, lineCount)
+	s.marquees = map[int]*marquee{}
+	s.drawUnlocked()
+}
+
+// Draw display the image
+func (s *Screen) Draw() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.drawUnlocked()
+}
+
+func (s *Screen) drawUnlocked() {
+	if s.blanked {
+		s.wakeDeviceUnlocked()
+	}
+	if td, ok := s.dev.(TextDevice); ok {
+		cols, rows := td.Size()
+		if err := td.WriteLines(textLayout(s.lines, cols, rows)); err != nil {
+			logger.Errorf("draw error: %v", err)
+		}
+	} else {
+		s.drawStatusUnlocked()
+		s.frame = s.composeUnlocked()
+		if err := s.dev.Draw(s.dev.Bounds(), s.frame, image.Point{}); err != nil {
+			logger.Errorf("draw error: %v", err)
+		}
+	}
+	s.blanked = false
+	s.saver = false
+}
+
+// Blank blanks the screen without clearing the image
+func (s *Screen) Blank() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.dev.Halt(); err != nil {
+		logger.Errorf("halt error: %v", err)
+		return
+	}
+	s.blanked = true
+}
+
+// Blanked reports whether the screen is currently blanked
+func (s *Screen) Blanked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.blanked
+}
+
+// Lines returns the text of the lines, from the title to the help line
+func (s *Screen) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.lines...)
+}
+
+// Snapshot returns the frame last sent to the display as a scaled-up PNG.
+// The frame is returned even when the screen is blanked.
+func (s *Screen) Snapshot() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frame := s.frame
+	if frame == nil {
+		frame = s.img
+	}
+	if s.inverted && s.hwInvertUnlocked() {
+		frame = invert(frame)
+	}
+	return encodeSnapshot(frame)
+}
+
+func (s *Screen) markActivity() {
+	if time.Now().Sub(s.lastActive) > 1*time.Hour {
+		logger.Tracef("activity after more than an hour")
+	}
+
+	s.lastActive = time.Now()
+	if s.dimmed {
+		s.setContrastUnlocked(s.contrast)
+		s.dimmed = false
+	}
+}
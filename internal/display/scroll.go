@@ -0,0 +1,108 @@
+package display
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+)
+
+// the sh1106 has no hardware scrolling (the commands in sh1106.Dev.Scroll are
+// the ssd1306 ones), and hardware scrolling can only move whole 8 pixel pages anyway,
+// so lines are scrolled by redrawing them shifted
+const (
+	scrollTick  = 100 * time.Millisecond
+	scrollStep  = 3  // pixels per tick
+	scrollPause = 15 // ticks to wait at the beginning of the text
+	scrollGap   = "   "
+)
+
+// marquee is the scrolling state of a line
+type marquee struct {
+	text   string
+	offset int
+	pause  int
+}
+
+func (s *Screen) scrollLoop() {
+	t := time.NewTicker(scrollTick)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-t.C:
+			s.scroll()
+		}
+	}
+}
+
+func (s *Screen) scroll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// drawing would switch a blanked screen back on, or replace the screensaver
+	if len(s.marquees) == 0 || s.blanked || s.saver {
+		return
+	}
+
+	for line, m := range s.marquees {
+		if m.pause < scrollPause {
+			m.pause++
+			continue
+		}
+
+		// the text is drawn twice so that the beginning follows the end seamlessly
+		loop := m.text + scrollGap
+		m.offset += scrollStep
+		if w := font.MeasureString(smallFont, loop).Round(); m.offset >= w {
+			m.offset = 0
+			m.pause = 0
+		}
+		s.writeFaceUnlocked(mediumFont, smallFont, line, white, false, -m.offset, loop+m.text)
+	}
+	s.drawUnlocked()
+}
+
+// fits reports whether the text is narrower than width when drawn with the face f
+func fits(f font.Face, text string, width int) bool {
+	return font.MeasureString(f, text).Round() <= width
+}
+
+// wrap breaks the text into lines no wider than width at spaces,
+// words that are too long on their own are broken up
+func wrap(f font.Face, text string, width int) []string {
+	var ret []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if fits(f, candidate, width) {
+			line = candidate
+			continue
+		}
+
+		if line != "" {
+			ret = append(ret, line)
+			line = ""
+		}
+		for !fits(f, word, width) {
+			n := 1
+			for n < utf8.RuneCountInString(word) && fits(f, string([]rune(word)[:n+1]), width) {
+				n++
+			}
+			ret = append(ret, string([]rune(word)[:n]))
+			word = string([]rune(word)[n:])
+		}
+		line = word
+	}
+	if line != "" {
+		ret = append(ret, line)
+	}
+
+	return ret
+}
@@ -0,0 +1,32 @@
+package display
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// snapshotScale is how many times bigger the snapshot is than the real display,
+// a 128x64 image is unreadably small on a phone
+const snapshotScale = 4
+
+// encodeSnapshot scales up the src image with nearest-neighbor sampling
+// and encodes it as a PNG, lit pixels are white, everything else is black
+func encodeSnapshot(src image.Image) ([]byte, error) {
+	b := src.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, b.Dx()*snapshotScale, b.Dy()*snapshotScale))
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			c := color.GrayModel.Convert(src.At(b.Min.X+x/snapshotScale, b.Min.Y+y/snapshotScale))
+			dst.SetGray(x, y, c.(color.Gray))
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, dst); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
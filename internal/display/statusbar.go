@@ -0,0 +1,219 @@
+package display
+
+import (
+	"image"
+	"image/draw"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Status is shown as icons in the corners of the title bar
+type Status struct {
+	// WiFi is the signal strength in percent, negative when not connected
+	WiFi int
+	// DBDown signals that scans are not reaching the database
+	DBDown bool
+	// Pending is the number of scans not yet sent to the database
+	Pending int
+	// LowDisk signals that the storage is about to run out of space
+	LowDisk bool
+	// Battery is the charge in percent, negative without a battery
+	Battery int
+	// OnBattery signals that the external power is lost, the battery is highlighted
+	OnBattery bool
+	// Time is shown as HH:MM
+	Time time.Time
+}
+
+// tinyFont is a 3x5 pixel font for the status icons, each row is 3 bits wide
+var tinyFont = map[rune][5]byte{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 3, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 2, 2},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	':': {0, 2, 0, 2, 0},
+	'+': {0, 2, 7, 2, 0},
+	'!': {2, 2, 2, 0, 2},
+	'x': {0, 5, 2, 5, 0},
+	'%': {5, 1, 2, 4, 5},
+}
+
+const statusTop = 5 // the icons are vertically centered in the 16 pixel high title bar
+
+// SetStatus updates the icons in the title bar
+func (s *Screen) SetStatus(st Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status = &st
+	if s.blanked || s.saver {
+		return
+	}
+	s.drawUnlocked()
+}
+
+// drawStatusUnlocked draws the status icons into the title bar:
+// on the left the wifi signal, the battery, the database state and the number of pending scans,
+// on the right the low disk warning and the clock, the title is drawn again between them
+func (s *Screen) drawStatusUnlocked() {
+	st := s.status
+	if st == nil {
+		return
+	}
+
+	left := []func(x int) int{
+		func(x int) int { return s.drawWiFiUnlocked(x, st.WiFi) },
+	}
+	if st.Battery >= 0 {
+		left = append(left, func(x int) int { return s.drawBatteryUnlocked(x, st.Battery, st.OnBattery) })
+	}
+	if st.DBDown {
+		left = append(left, func(x int) int { return s.drawTinyUnlocked(x, "x") })
+	}
+	if st.Pending > 0 {
+		p := strconv.Itoa(st.Pending)
+		if st.Pending > 999 {
+			p = "999+"
+		}
+		left = append(left, func(x int) int { return s.drawTinyUnlocked(x, p) })
+	}
+
+	var right []string
+	if st.LowDisk {
+		right = append(right, "!")
+	}
+	if !st.Time.IsZero() {
+		right = append(right, st.Time.Format("15:04"))
+	}
+
+	title := s.lines[0]
+	if title != "" {
+		// the title written full width would run under the icons
+		draw.Draw(s.img, s.titleRectUnlocked(), &image.Uniform{white}, image.ZP, draw.Src)
+	}
+
+	x := 1
+	for _, f := range left {
+		x = f(x) + 2
+	}
+	start := x
+
+	w := s.img.Bounds().Dx()
+	x = w - 1
+	for i := len(right) - 1; i >= 0; i-- {
+		x -= tinyWidth(right[i])
+		s.drawTinyUnlocked(x, right[i])
+		x -= 2
+	}
+
+	if title != "" {
+		s.drawTitleUnlocked(title, start, x)
+	}
+}
+
+// titleRectUnlocked is the area of the title bar
+func (s *Screen) titleRectUnlocked() image.Rectangle {
+	base := s.baselineUnlocked(titleFont, 0)
+	return image.Rect(0, base-titleFont.Metrics().Ascent.Round(), s.img.Bounds().Dx(), base+1)
+}
+
+// drawTitleUnlocked draws the title centered between left and right, with smaller fonts
+// when it does not fit between them, cut at the end when it does not fit even that way
+func (s *Screen) drawTitleUnlocked(text string, left, right int) {
+	var f font.Face = titleFont
+	for _, smaller := range []font.Face{smallFont, narrowFont} {
+		if font.MeasureString(f, text).Round() <= right-left {
+			break
+		}
+		f = smaller
+	}
+	for text != "" && font.MeasureString(f, text).Round() > right-left {
+		_, n := utf8.DecodeLastRuneInString(text)
+		text = text[:len(text)-n]
+	}
+
+	d := font.Drawer{
+		Dst:  s.img,
+		Src:  &image.Uniform{black},
+		Face: f,
+	}
+	x := left + (right-left-d.MeasureString(text).Round())/2
+	d.Dot = fixed.P(x, s.baselineUnlocked(titleFont, 0))
+	d.DrawString(text)
+}
+
+// drawWiFiUnlocked draws 4 bars of increasing height, filled according to the signal
+func (s *Screen) drawWiFiUnlocked(x, signal int) int {
+	s.clearStatusUnlocked(x, 8)
+	for i := 0; i < 4; i++ {
+		h := 2 + i
+		bar := image.Rect(x+i*2, statusTop+5-h, x+i*2+1, statusTop+5)
+		if signal < 0 || signal < i*25+1 {
+			// only the bottom pixel of bars without signal
+			bar.Min.Y = bar.Max.Y - 1
+		}
+		draw.Draw(s.img, bar, &image.Uniform{black}, image.ZP, draw.Src)
+	}
+	if signal < 0 {
+		return s.drawTinyUnlocked(x+8, "x")
+	}
+	return x + 6
+}
+
+// drawTinyUnlocked draws the text with tinyFont and returns the x coordinate of its end
+func (s *Screen) drawTinyUnlocked(x int, text string) int {
+	s.clearStatusUnlocked(x, tinyWidth(text))
+	for _, r := range text {
+		g := tinyFont[r]
+		for row := 0; row < 5; row++ {
+			for col := 0; col < 3; col++ {
+				if g[row]&(4>>uint(col)) != 0 {
+					s.img.SetBit(x+col, statusTop+row, black)
+				}
+			}
+		}
+		x += 4
+	}
+	return x - 1
+}
+
+// clearStatusUnlocked clears the area behind an icon, so that the title does not run into it
+func (s *Screen) clearStatusUnlocked(x, w int) {
+	r := image.Rect(x-1, statusTop-1, x+w+1, statusTop+6)
+	draw.Draw(s.img, r, &image.Uniform{white}, image.ZP, draw.Src)
+}
+
+// drawBatteryUnlocked draws the percentage of the battery, inverted when on battery
+func (s *Screen) drawBatteryUnlocked(x, battery int, onBattery bool) int {
+	text := strconv.Itoa(battery) + "%"
+	end := s.drawTinyUnlocked(x, text)
+	if !onBattery {
+		return end
+	}
+
+	// the cleared area around the text
+	for py := statusTop - 1; py < statusTop+6; py++ {
+		for px := x - 1; px <= end+1; px++ {
+			s.img.SetBit(px, py, !s.img.BitAt(px, py))
+		}
+	}
+	return end + 1
+}
+
+func tinyWidth(text string) int {
+	n := 0
+	for range text {
+		n += 4
+	}
+	return n - 1
+}
@@ -0,0 +1,49 @@
+package display
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// TextDevice is a Device that can only show characters,
+// the Screen sends it the lines of text instead of the rendered frame
+type TextDevice interface {
+	Device
+	Size() (cols, rows int)
+	WriteLines(lines []string) error
+}
+
+// textLayout fits the lines of the Screen onto a character display,
+// the title and help are centered like on the graphical layout.
+// With less than four rows the help is dropped, with two rows
+// only the title and the most important (last non-empty) line are kept.
+func textLayout(lines []string, cols, rows int) []string {
+	title := center(lines[0], cols)
+	if rows >= lineCount {
+		ret := []string{title}
+		ret = append(ret, lines[1:lineCount-1]...)
+		ret = append(ret, center(lines[lineCount-1], cols))
+		return ret
+	}
+
+	if rows == 3 {
+		return []string{title, lines[1], lines[2]}
+	}
+
+	line := lines[2]
+	if strings.TrimSpace(line) == "" {
+		line = lines[1]
+	}
+	if rows == 1 {
+		return []string{line}
+	}
+	return []string{title, line}
+}
+
+func center(text string, cols int) string {
+	n := utf8.RuneCountInString(text)
+	if n >= cols {
+		return text
+	}
+	return strings.Repeat(" ", (cols-n)/2) + text
+}
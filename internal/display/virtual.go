@@ -0,0 +1,107 @@
+package display
+
+import (
+	"image"
+	"image/draw"
+	"strings"
+	"sync"
+
+	"periph.io/x/periph/devices/ssd1306/image1bit"
+)
+
+// Virtual is a Device that renders into an in-memory image,
+// it is used on development machines and for checking layouts
+type Virtual struct {
+	mu     sync.Mutex
+	img    *image1bit.VerticalLSB
+	halted bool
+}
+
+// NewVirtual returns a Virtual device the size of the sh1106 (128x64)
+func NewVirtual() *Virtual {
+	return &Virtual{
+		img: image1bit.NewVerticalLSB(image.Rect(0, 0, 128, 64)),
+	}
+}
+
+// Bounds implements Device
+func (v *Virtual) Bounds() image.Rectangle {
+	return v.img.Bounds()
+}
+
+// Draw implements Device
+func (v *Virtual) Draw(r image.Rectangle, src image.Image, sp image.Point) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	draw.Src.Draw(v.img, r, src, sp)
+	v.halted = false
+	return nil
+}
+
+// Halt implements Device
+func (v *Virtual) Halt() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.halted = true
+	return nil
+}
+
+// Halted reports whether the device would be switched off
+func (v *Virtual) Halted() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.halted
+}
+
+// Image returns a copy of the last frame drawn
+func (v *Virtual) Image() image.Image {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	ret := image1bit.NewVerticalLSB(v.img.Bounds())
+	copy(ret.Pix, v.img.Pix)
+	return ret
+}
+
+// PNG returns the last frame drawn as a scaled-up PNG
+func (v *Virtual) PNG() ([]byte, error) {
+	return encodeSnapshot(v.Image())
+}
+
+// String renders the last frame for a terminal, two pixel rows per character
+func (v *Virtual) String() string {
+	img := v.Image()
+	b := img.Bounds()
+	lit := func(x, y int) bool {
+		if y >= b.Max.Y {
+			return false
+		}
+		return img.At(x, y) == image1bit.On
+	}
+
+	sb := strings.Builder{}
+	border := "+" + strings.Repeat("-", b.Dx()) + "+\n"
+	sb.WriteString(border)
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		sb.WriteByte('|')
+		for x := b.Min.X; x < b.Max.X; x++ {
+			switch top, bottom := lit(x, y), lit(x, y+1); {
+			case top && bottom:
+				sb.WriteRune('█')
+			case top:
+				sb.WriteRune('▀')
+			case bottom:
+				sb.WriteRune('▄')
+			default:
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	sb.WriteString(border)
+
+	return sb.String()
+}
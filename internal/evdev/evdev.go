@@ -0,0 +1,317 @@
+// +build linux
+
+// package evdev reads barcode scanners as linux input devices, so the app does not need a tty
+package evdev
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unicode"
+	"unsafe"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/tty"
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("main.evdev")
+
+// RetryInterval is the time between looking for the device when it is not plugged in
+var RetryInterval = 1 * time.Second
+
+var ErrNoDevice = errors.New("no matching input device")
+
+// ioctl numbers from linux/input.h, they are the same on arm and amd64
+const (
+	eviocgid   = 0x80084502 // _IOR('E', 0x02, struct input_id)
+	eviocgrab  = 0x40044590 // _IOW('E', 0x90, int)
+	eviocgname = 0x80004506 // _IOC(_IOC_READ, 'E', 0x06, len)
+)
+
+// key codes from linux/input-event-codes.h
+const (
+	keyEsc        = 1
+	keyBackspace  = 14
+	keyTab        = 15
+	keyEnter      = 28
+	keyLeftShift  = 42
+	keyRightShift = 54
+	keyCapsLock   = 58
+	keyF1         = 59
+	keyF10        = 68
+	keyF11        = 87
+	keyF12        = 88
+	keyKPEnter    = 96
+	keyRightAlt   = 100
+	keyHome       = 102
+	keyUp         = 103
+	keyPageUp     = 104
+	keyLeft       = 105
+	keyRight      = 106
+	keyEnd        = 107
+	keyDown       = 108
+	keyPageDown   = 109
+	keyInsert     = 110
+	keyDelete     = 111
+)
+
+const (
+	evKey = 0x01
+
+	keyReleased = 0
+	keyPressed  = 1
+	keyRepeated = 2
+)
+
+// event is struct input_event, the size of the timeval depends on the platform
+type event struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// inputID is struct input_id
+type inputID struct {
+	Bustype uint16
+	Vendor  uint16
+	Product uint16
+	Version uint16
+}
+
+// Device reads the runes typed by an input device, it implements input.Source
+// the device is grabbed exclusively so the keystrokes do not reach the console,
+// when it is unplugged, ReadRune waits for it to be plugged in again
+type Device struct {
+	ctx context.Context
+	// path is the device to read, ex: /dev/input/by-id/..., empty means the first
+	// device with the vendor and product id
+	path    string
+	vendor  uint16
+	product uint16
+	layout  tty.Layout
+
+	f    *os.File
+	name string
+	// at is when the kernel got the key last returned
+	at time.Time
+	// the state of the modifier keys
+	shift, altgr, caps bool
+}
+
+// Open returns a Device reading the input device at path, or the first one with the vendor
+// and product id not read by others when path is empty, it is fine if the device is not plugged in yet
+func Open(ctx context.Context, path string, vendor, product uint16, layout tty.Layout) (*Device, error) {
+	if layout == nil {
+		return nil, errors.New("no keyboard layout")
+	}
+
+	d := &Device{
+		ctx:     ctx,
+		path:    path,
+		vendor:  vendor,
+		product: product,
+		layout:  layout,
+	}
+	if err := d.open(); err != nil && err != ErrNoDevice {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// open grabs the device at the path or the first matching device not grabbed yet
+func (d *Device) open() error {
+	paths := []string{d.path}
+	if d.path == "" {
+		var err error
+		if paths, err = filepath.Glob("/dev/input/event*"); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			logger.Tracef("open %v failed: %v", p, err)
+			continue
+		}
+
+		id := inputID{}
+		err = ioctl(f, eviocgid, uintptr(unsafe.Pointer(&id)))
+		if d.path == "" && (err != nil || id.Vendor != d.vendor || id.Product != d.product) {
+			_ = f.Close()
+			continue
+		}
+
+		if err := ioctl(f, eviocgrab, 1); err != nil {
+			_ = f.Close()
+			if err == syscall.EBUSY {
+				// read by another input, ex: an identical scanner
+				logger.Tracef("%v is grabbed already", p)
+				continue
+			}
+			return fmt.Errorf("grabbing %v failed: %v", p, err)
+		}
+
+		d.f = f
+		d.name = deviceName(f)
+		d.shift, d.altgr = false, false
+		logger.Infof("reading input from %v (%v, %04x:%04x)", p, d.name, id.Vendor, id.Product)
+		return nil
+	}
+
+	return ErrNoDevice
+}
+
+func deviceName(f *os.File) string {
+	buf := make([]byte, 256)
+	if err := ioctl(f, eviocgname|uintptr(len(buf))<<16, uintptr(unsafe.Pointer(&buf[0]))); err != nil {
+		return "unknown"
+	}
+
+	for i, b := range buf {
+		if b == 0 {
+			return string(buf[:i])
+		}
+	}
+	return string(buf)
+}
+
+func ioctl(f *os.File, req, arg uintptr) error {
+	if _, _, err := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, arg); err != 0 {
+		return err
+	}
+	return nil
+}
+
+// ReadRune blocks until a key producing a rune is pressed, reconnecting to the device if needed
+func (d *Device) ReadRune() (rune, int, error) {
+	for {
+		if d.ctx.Err() != nil {
+			return '\n', 1, nil
+		}
+
+		if d.f == nil {
+			if err := d.open(); err != nil {
+				if err != ErrNoDevice {
+					logger.Warningf("open failed: %v", err)
+				}
+
+				select {
+				case <-d.ctx.Done():
+				case <-time.After(RetryInterval):
+				}
+				continue
+			}
+		}
+
+		ev := event{}
+		if err := binary.Read(d.f, binary.LittleEndian, &ev); err != nil {
+			// most likely unplugged, ENODEV
+			logger.Warningf("input device %v lost: %v", d.name, err)
+			_ = d.f.Close()
+			d.f = nil
+			continue
+		}
+
+		if ev.Type != evKey {
+			continue
+		}
+		if r, ok := d.translate(ev.Code, ev.Value); ok {
+			d.at = time.Unix(int64(ev.Time.Sec), int64(ev.Time.Usec)*1000)
+			return r, 1, nil
+		}
+	}
+}
+
+// ReadTime returns when the key last returned by ReadRune was pressed, the app may take
+// the runes later
+func (d *Device) ReadTime() time.Time {
+	return d.at
+}
+
+// translate tracks the modifiers and returns the rune produced by the key, if any
+func (d *Device) translate(code uint16, value int32) (rune, bool) {
+	switch code {
+	case keyLeftShift, keyRightShift:
+		d.shift = value != keyReleased
+		return 0, false
+	case keyRightAlt:
+		d.altgr = value != keyReleased
+		return 0, false
+	case keyCapsLock:
+		if value == keyPressed {
+			d.caps = !d.caps
+		}
+		return 0, false
+	}
+
+	if value == keyReleased {
+		return 0, false
+	}
+
+	if r, ok := specialKeys[code]; ok {
+		return r, true
+	}
+
+	runes, ok := d.layout[code]
+	if !ok {
+		logger.Tracef("unmapped key code: %v", code)
+		return 0, false
+	}
+
+	r := runes[0]
+	switch {
+	case d.altgr:
+		r = runes[2]
+	case d.shift != (d.caps && unicode.IsLetter(runes[0])):
+		r = runes[1]
+	}
+	return r, r != 0
+}
+
+// Close releases the device
+func (d *Device) Close() error {
+	if d.f == nil {
+		return nil
+	}
+
+	_ = ioctl(d.f, eviocgrab, 0)
+	err := d.f.Close()
+	d.f = nil
+	return err
+}
+
+// the keys that are the same in every layout
+var specialKeys = map[uint16]rune{
+	keyEsc:       tty.KeyEscape,
+	keyEnter:     '\n',
+	keyKPEnter:   '\n',
+	keyBackspace: tty.KeyBackspace,
+	keyDelete:    tty.KeyDelete,
+	keyUp:        tty.KeyArrowUp,
+	keyDown:      tty.KeyArrowDown,
+	keyLeft:      tty.KeyArrowLeft,
+	keyRight:     tty.KeyArrowRight,
+	keyTab:       '\t',
+	keyHome:      tty.SpecialKeyHome,
+	keyEnd:       tty.SpecialKeyEnd,
+	keyPageUp:    tty.SpecialKeyPageUp,
+	keyPageDown:  tty.SpecialKeyPageDown,
+	keyInsert:    tty.SpecialKeyInsert,
+	keyF11:       tty.KeyF11,
+	keyF12:       tty.KeyF12,
+}
+
+func init() {
+	// F1-F10 have consecutive codes
+	for i := 0; i <= keyF10-keyF1; i++ {
+		specialKeys[uint16(keyF1+i)] = tty.KeyF1 + rune(i)
+	}
+}
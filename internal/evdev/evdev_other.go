@@ -0,0 +1,25 @@
+// +build !linux
+
+package evdev
+
+import (
+	"context"
+	"errors"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/tty"
+)
+
+type Device struct {
+}
+
+func Open(ctx context.Context, path string, vendor, product uint16, layout tty.Layout) (*Device, error) {
+	return nil, errors.New("unimplemented")
+}
+
+func (d *Device) ReadRune() (rune, int, error) {
+	return 0, 0, errors.New("unimplemented")
+}
+
+func (d *Device) Close() error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package feedback
+
+import (
+	"context"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/buzzer"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/gpio"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
+)
+
+// Drivers are the drivers selectable by name, see config.FeedbackDriver
+var Drivers = map[string]func() Driver{
+	"buzzer":  func() Driver { return Buzzer{} },
+	"gpio":    func() Driver { return GPIO{} },
+	"console": func() Driver { return Console{} },
+	"none":    func() Driver { return Nop{} },
+}
+
+// Buzzer plays the tones on the pwm buzzer of the v1 hardware, it has no leds
+type Buzzer struct{}
+
+func (Buzzer) Play(ctx context.Context, p pattern.Pattern) error {
+	return buzzer.Play(ctx, p.Tones)
+}
+
+// GPIO plays the patterns on the beeper and the leds of the v2 hardware
+type GPIO struct{}
+
+func (GPIO) Play(ctx context.Context, p pattern.Pattern) error {
+	return gpio.Play(ctx, p)
+}
+
+// Console logs the patterns instead of playing them, for development
+type Console struct{}
+
+func (Console) Play(ctx context.Context, p pattern.Pattern) error {
+	logger.Infof("feedback: %v", p.Name)
+	return nil
+}
+
+// Nop does nothing
+type Nop struct{}
+
+func (Nop) Play(ctx context.Context, p pattern.Pattern) error {
+	return nil
+}
+
+// Sender sends commands to a device, see serial.Port
+type Sender interface {
+	Send(cmd string) error
+}
+
+// Scanner sends the command of the pattern to the scanner, so it can beep or flash on its own,
+// the patterns without a command are skipped
+type Scanner struct {
+	Port Sender
+	// Commands are the commands by pattern name
+	Commands map[string]string
+}
+
+func (s Scanner) Play(ctx context.Context, p pattern.Pattern) error {
+	cmd := s.Commands[p.Name]
+	if cmd == "" {
+		return nil
+	}
+	return s.Port.Send(cmd)
+}
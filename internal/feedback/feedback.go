@@ -0,0 +1,175 @@
+// package feedback signals the outcomes to the operator with the buzzer, the leds or the scanner itself
+package feedback
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("main.feedback")
+
+// Feedback signals the outcomes to the operator, the methods return once the pattern started
+// except Shutdown, which blocks until the pattern is over
+type Feedback interface {
+	Boot()
+	Shutdown()
+	Success()
+	Fail()
+	Warn()
+	Duplicate()
+	Busy()
+}
+
+// Driver plays patterns on a device
+type Driver interface {
+	Play(ctx context.Context, p pattern.Pattern) error
+}
+
+// Patterns are the patterns of the outcomes by name, the leds are left green
+// unless the device is shutting down, the tones are in the format of pattern.ParseTones
+var Patterns = map[string]pattern.Pattern{
+	"boot": {
+		Tones: pattern.MustParseTones("c6:80ms e6:80ms g6:80ms c7:160ms"),
+		Rest:  pattern.Green,
+	},
+	"shutdown": {
+		Tones: pattern.MustParseTones("c7:80ms g6:80ms c6:160ms"),
+		Rest:  pattern.Red,
+	},
+	"success": {
+		Tones:  pattern.MustParseTones("2068:150ms"),
+		Lights: []pattern.Light{light(pattern.Blue, 500*time.Millisecond)},
+		Rest:   pattern.Green,
+	},
+	"fail": {
+		Tones: pattern.MustParseTones("a4:75ms r:75ms a4:75ms r:75ms a4:75ms r:75ms a4:75ms"),
+		Lights: []pattern.Light{
+			light(pattern.Red, 166*time.Millisecond), light(0, 166*time.Millisecond),
+			light(pattern.Red, 166*time.Millisecond), light(0, 166*time.Millisecond),
+			light(pattern.Red, 166*time.Millisecond), light(0, 166*time.Millisecond),
+		},
+		Rest: pattern.Green,
+	},
+	"warn": {
+		Tones:  pattern.MustParseTones("e6:150ms r:75ms c6:150ms"),
+		Lights: []pattern.Light{light(pattern.Red|pattern.Blue, 500*time.Millisecond)},
+		Rest:   pattern.Green,
+	},
+	"duplicate": {
+		Tones:  pattern.MustParseTones("c7:60ms r:60ms c7:60ms"),
+		Lights: []pattern.Light{light(pattern.Blue, 75*time.Millisecond), light(0, 75*time.Millisecond), light(pattern.Blue, 75*time.Millisecond)},
+		Rest:   pattern.Green,
+	},
+	"busy": {
+		Tones:  pattern.MustParseTones("g5:30ms@40"),
+		Lights: []pattern.Light{light(pattern.Blue|pattern.Green, 200*time.Millisecond)},
+		Rest:   pattern.Green,
+	},
+}
+
+func light(leds pattern.LED, d time.Duration) pattern.Light {
+	return pattern.Light{LEDs: leds, Durr: d}
+}
+
+// SetTones replaces the tones of the pattern, it must be called before playing anything
+func SetTones(name string, tones []pattern.Tone) error {
+	p, ok := Patterns[name]
+	if !ok {
+		return fmt.Errorf("unknown pattern: %v", name)
+	}
+
+	p.Tones = tones
+	Patterns[name] = p
+	return nil
+}
+
+// Player plays the patterns of the outcomes on a driver from a single goroutine,
+// a new pattern cuts the one playing short instead of queueing after it
+type Player struct {
+	ctx     context.Context
+	driver  Driver
+	plays   chan play
+	stopped chan struct{}
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+type play struct {
+	ctx  context.Context
+	name string
+	done chan struct{}
+}
+
+func New(ctx context.Context, driver Driver) *Player {
+	f := &Player{
+		ctx:     ctx,
+		driver:  driver,
+		plays:   make(chan play),
+		stopped: make(chan struct{}),
+		cancel:  func() {},
+	}
+	go f.run()
+	return f
+}
+
+func (f *Player) Boot()      { f.start(f.ctx, "boot") }
+func (f *Player) Success()   { f.start(f.ctx, "success") }
+func (f *Player) Fail()      { f.start(f.ctx, "fail") }
+func (f *Player) Warn()      { f.start(f.ctx, "warn") }
+func (f *Player) Duplicate() { f.start(f.ctx, "duplicate") }
+func (f *Player) Busy()      { f.start(f.ctx, "busy") }
+
+// Shutdown is played after the app is done, so it does not use its context
+func (f *Player) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	<-f.start(ctx, "shutdown")
+}
+
+// start cancels the pattern playing and hands the next one to the player goroutine,
+// the returned channel is closed when the pattern is over
+func (f *Player) start(parent context.Context, name string) <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.cancel()
+	ctx, cancel := context.WithCancel(parent)
+	f.cancel = cancel
+
+	p := play{ctx: ctx, name: name, done: make(chan struct{})}
+	select {
+	case f.plays <- p:
+	case <-f.stopped:
+		// nothing else plays on the driver after the app is done
+		f.play(p)
+	}
+	return p.done
+}
+
+func (f *Player) run() {
+	defer close(f.stopped)
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case p := <-f.plays:
+			f.play(p)
+		}
+	}
+}
+
+func (f *Player) play(pl play) {
+	defer close(pl.done)
+
+	p := Patterns[pl.name]
+	p.Name = pl.name
+	if err := f.driver.Play(pl.ctx, p); err != nil && pl.ctx.Err() == nil {
+		logger.Infof("playing %v failed: %v", pl.name, err)
+	}
+}
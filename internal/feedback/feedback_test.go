@@ -0,0 +1,55 @@
+package feedback
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
+)
+
+// blockingDriver plays every pattern until its context is done
+type blockingDriver struct {
+	started chan string
+	stopped chan string
+}
+
+func (d blockingDriver) Play(ctx context.Context, p pattern.Pattern) error {
+	d.started <- p.Name
+	<-ctx.Done()
+	d.stopped <- p.Name
+	return ctx.Err()
+}
+
+func TestPlayerCancels(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := blockingDriver{started: make(chan string, 10), stopped: make(chan string, 10)}
+	f := New(ctx, d)
+
+	f.Success()
+	expect(t, d.started, "success")
+
+	// the next pattern cuts the one playing short, the calls do not block
+	f.Fail()
+	expect(t, d.stopped, "success")
+	expect(t, d.started, "fail")
+	f.Busy()
+	expect(t, d.stopped, "fail")
+	expect(t, d.started, "busy")
+
+	cancel()
+	expect(t, d.stopped, "busy")
+}
+
+func expect(t *testing.T, c chan string, want string) {
+	t.Helper()
+
+	select {
+	case got := <-c:
+		if got != want {
+			t.Fatalf("got %q, expected %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %q", want)
+	}
+}
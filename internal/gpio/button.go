@@ -0,0 +1,131 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultDebounce  = 30 * time.Millisecond
+	defaultLongPress = time.Second
+)
+
+// Press is a press of a button, long presses are sent while the button is still held
+type Press struct {
+	Button string
+	Long   bool
+}
+
+func (p Press) String() string {
+	if p.Long {
+		return p.Button + ":long"
+	}
+	return p.Button
+}
+
+// WatchButtons sends the presses of the buttons of opts until ctx is done,
+// a button held at the start is only pressed once it is released
+func WatchButtons(ctx context.Context, opts *Opts, presses chan<- Press) error {
+	if len(opts.Buttons) == 0 {
+		return nil
+	}
+
+	b, err := openBackend(opts)
+	if err != nil {
+		return err
+	}
+
+	debounce, long := opts.Debounce, opts.LongPress
+	if debounce <= 0 {
+		debounce = defaultDebounce
+	}
+	if long <= 0 {
+		long = defaultLongPress
+	}
+
+	for name, p := range opts.Buttons {
+		levels, err := b.watch(ctx, name, p)
+		if err != nil {
+			return fmt.Errorf("failed to watch button %v %v: %v", name, p, err)
+		}
+		go watchButton(ctx, name, levels, presses, debounce, long)
+	}
+	return nil
+}
+
+// watchButton turns the values of the line into presses, the value has to be stable
+// for debounce to count, so the bouncing of the contacts is ignored
+func watchButton(ctx context.Context, name string, levels <-chan bool, presses chan<- Press, debounce, long time.Duration) {
+	send := func(p Press) {
+		select {
+		case <-ctx.Done():
+		case presses <- p:
+		}
+	}
+
+	var level, held, longSent bool
+	select {
+	case <-ctx.Done():
+		return
+	case level = <-levels:
+		held = level
+		// held at the start, released first
+		longSent = level
+	}
+
+	settle := time.NewTimer(debounce)
+	settle.Stop()
+	defer settle.Stop()
+	hold := time.NewTimer(long)
+	hold.Stop()
+	defer hold.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case l, ok := <-levels:
+			if !ok {
+				return
+			}
+			level = l
+			stopTimer(settle)
+			settle.Reset(debounce)
+
+		case <-settle.C:
+			if level == held {
+				continue
+			}
+			held = level
+			if held {
+				longSent = false
+				hold.Reset(long)
+				continue
+			}
+
+			stopTimer(hold)
+			if !longSent {
+				send(Press{Button: name})
+			}
+			longSent = false
+
+		case <-hold.C:
+			if held && !longSent {
+				longSent = true
+				send(Press{Button: name, Long: true})
+			}
+		}
+	}
+}
+
+// stopTimer stops t and drains it, so it can be reset
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
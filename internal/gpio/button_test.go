@@ -0,0 +1,105 @@
+package gpio
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	testDebounce  = 20 * time.Millisecond
+	testLongPress = 200 * time.Millisecond
+)
+
+// step sets the level of the fake line, then waits
+type step struct {
+	level bool
+	wait  time.Duration
+}
+
+func TestWatchButton(t *testing.T) {
+	bounce := time.Millisecond
+	settled := 3 * testDebounce
+
+	tests := []struct {
+		name    string
+		initial bool
+		steps   []step
+		want    []Press
+	}{
+		{
+			"press",
+			false,
+			[]step{{true, settled}, {false, settled}},
+			[]Press{{Button: "a"}},
+		},
+		{
+			"bouncing press",
+			false,
+			[]step{
+				{true, bounce}, {false, bounce}, {true, bounce}, {false, bounce}, {true, settled},
+				{false, bounce}, {true, bounce}, {false, settled},
+			},
+			[]Press{{Button: "a"}},
+		},
+		{
+			"glitch",
+			false,
+			[]step{{true, bounce}, {false, settled}},
+			nil,
+		},
+		{
+			"two presses",
+			false,
+			[]step{{true, settled}, {false, settled}, {true, settled}, {false, settled}},
+			[]Press{{Button: "a"}, {Button: "a"}},
+		},
+		{
+			"long press",
+			false,
+			[]step{{true, testLongPress + settled}, {false, settled}},
+			[]Press{{Button: "a", Long: true}},
+		},
+		{
+			"long press then press",
+			false,
+			[]step{{true, testLongPress + settled}, {false, settled}, {true, settled}, {false, settled}},
+			[]Press{{Button: "a", Long: true}, {Button: "a"}},
+		},
+		{
+			"held at the start",
+			true,
+			[]step{{true, testLongPress + settled}, {false, settled}, {true, settled}, {false, settled}},
+			[]Press{{Button: "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			levels := make(chan bool)
+			presses := make(chan Press, 10)
+			go watchButton(ctx, "a", levels, presses, testDebounce, testLongPress)
+
+			levels <- tt.initial
+			for _, s := range tt.steps {
+				levels <- s.level
+				time.Sleep(s.wait)
+			}
+			close(levels)
+
+			var got []Press
+			for len(presses) > 0 {
+				got = append(got, <-presses)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pressed %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+// +build linux
+
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// the line handle ABI of linux/gpio.h, supported since 4.8
+const (
+	getLineHandleIoctl = 0xc16cb403 // _IOWR(0xB4, 0x03, struct gpiohandle_request)
+	getLineEventIoctl  = 0xc030b404 // _IOWR(0xB4, 0x04, struct gpioevent_request)
+	getLineValuesIoctl = 0xc040b408 // _IOWR(0xB4, 0x08, struct gpiohandle_data)
+	setLineValuesIoctl = 0xc040b409 // _IOWR(0xB4, 0x09, struct gpiohandle_data)
+
+	handleRequestInput     = 1 << 0
+	handleRequestOutput    = 1 << 1
+	handleRequestActiveLow = 1 << 2
+	handleRequestPullUp    = 1 << 5
+
+	eventRequestBothEdges = 0x3
+	eventRisingEdge       = 0x1
+
+	handlesMax = 64
+)
+
+type handleRequest struct {
+	lineOffsets   [handlesMax]uint32
+	flags         uint32
+	defaultValues [handlesMax]uint8
+	consumerLabel [32]byte
+	lines         uint32
+	fd            int32
+}
+
+type eventRequest struct {
+	lineOffset    uint32
+	handleFlags   uint32
+	eventFlags    uint32
+	consumerLabel [32]byte
+	fd            int32
+}
+
+// eventData is struct gpioevent_data, a timestamp in ns and the id of the edge
+type eventData struct {
+	timestamp uint64
+	id        uint32
+	_         uint32
+}
+
+type handleData struct {
+	values [handlesMax]uint8
+}
+
+// chardev requests the lines on /dev/gpiochipN, the lines are released when the app exits
+type chardev struct {
+	chip *os.File
+}
+
+func openChip(path string) (backend, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &chardev{chip: f}, nil
+}
+
+type chardevLine struct {
+	c    *chardev
+	name string
+	cfg  Pin
+	// fd is the line handle, -1 if not requested
+	fd int
+}
+
+func (c *chardev) open(name string, p Pin) (line, error) {
+	l := &chardevLine{c: c, name: name, cfg: p, fd: -1}
+	if p.Direction {
+		// not requested until it is set, so it stays as it is, direction pins are on by default
+		return l, nil
+	}
+	if err := l.request(handleRequestOutput); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *chardevLine) set(on bool) error {
+	if l.cfg.Direction {
+		// the line is requested again with the other direction
+		if on {
+			return l.request(handleRequestInput)
+		}
+		return l.request(handleRequestOutput)
+	}
+
+	var data handleData
+	if on {
+		data.values[0] = 1
+	}
+	return ioctl(uintptr(l.fd), setLineValuesIoctl, unsafe.Pointer(&data))
+}
+
+// request releases the line if it was requested, then requests it with the flags,
+// outputs start off
+func (l *chardevLine) request(flags uint32) error {
+	if l.fd >= 0 {
+		_ = syscall.Close(l.fd)
+		l.fd = -1
+	}
+
+	req := handleRequest{lines: 1, flags: flags}
+	req.lineOffsets[0] = uint32(l.cfg.Line)
+	if l.cfg.ActiveLow {
+		req.flags |= handleRequestActiveLow
+	}
+	if l.cfg.PullUp {
+		req.flags |= handleRequestPullUp
+	}
+	copy(req.consumerLabel[:len(req.consumerLabel)-1], "barcode-scanner "+l.name)
+
+	if err := ioctl(l.c.chip.Fd(), getLineHandleIoctl, unsafe.Pointer(&req)); err != nil {
+		return fmt.Errorf("line request failed: %v", err)
+	}
+	l.fd = int(req.fd)
+	return nil
+}
+
+func (c *chardev) watch(ctx context.Context, name string, p Pin) (<-chan bool, error) {
+	req := eventRequest{
+		lineOffset:  uint32(p.Line),
+		handleFlags: handleRequestInput,
+		eventFlags:  eventRequestBothEdges,
+	}
+	if p.ActiveLow {
+		req.handleFlags |= handleRequestActiveLow
+	}
+	if p.PullUp {
+		req.handleFlags |= handleRequestPullUp
+	}
+	copy(req.consumerLabel[:len(req.consumerLabel)-1], "barcode-scanner "+name)
+
+	if err := ioctl(c.chip.Fd(), getLineEventIoctl, unsafe.Pointer(&req)); err != nil {
+		return nil, fmt.Errorf("line event request failed: %v", err)
+	}
+	fd := int(req.fd)
+
+	var data handleData
+	if err := ioctl(uintptr(fd), getLineValuesIoctl, unsafe.Pointer(&data)); err != nil {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("reading the line failed: %v", err)
+	}
+
+	levels := make(chan bool, 1)
+	levels <- data.values[0] == 1
+	// the kernel queues the edges, the read blocks until the next one,
+	// it is only stopped by the app exiting
+	go func() {
+		defer close(levels)
+		for {
+			var ev eventData
+			buf := (*[unsafe.Sizeof(ev)]byte)(unsafe.Pointer(&ev))[:]
+			if _, err := syscall.Read(fd, buf); err != nil {
+				if err == syscall.EINTR {
+					continue
+				}
+				logger.Errorf("reading the events of %v failed: %v", name, err)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				_ = syscall.Close(fd)
+				return
+			case levels <- ev.id == eventRisingEdge:
+			}
+		}
+	}()
+	return levels, nil
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package gpio
+
+import (
+	"errors"
+)
+
+func openChip(path string) (backend, error) {
+	return nil, errors.New("unimplemented")
+}
@@ -1,236 +1,268 @@
+// package gpio drives the beeper and the status leds of the v2 hardware,
+// on the gpio character device or the deprecated sysfs interface
 package gpio
 
 import (
 	"context"
 	"fmt"
-	"io"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/leds"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
+	"github.com/juju/loggo"
 	"golang.org/x/sync/errgroup"
 )
 
-// orangepi pc plus gpio numbering:
-// (position of letter in alphabet - 1) * 32 + pin number
-// Beeper - PA20 => 20
-const base = "/sys/class/gpio"
-const beepDurr = 150 * time.Millisecond
-const flashDurr = 500 * time.Millisecond
-
-type dir string
-
-var (
-	in  dir = "in"
-	out dir = "out"
-)
-
-type pin struct {
-	mu  sync.Mutex
-	pin string
-}
-
-func (p *pin) String() string {
-	return "GPIO PIN: " + p.pin
-}
-
-func (p *pin) Enable() error {
-	return write(gpioPath(p.pin, "value"), "1")
+var logger = loggo.GetLogger("main.gpio")
+
+// Pin is a line of the gpio chip
+type Pin struct {
+	// Line is the offset of the line on the chip,
+	// orangepi pc plus: (position of letter in alphabet - 1) * 32 + pin number, ex: PA20 => 20
+	Line int
+	// ActiveLow pins are on when the line is low
+	ActiveLow bool
+	// Direction pins are on while the line is an input and off while it is driven,
+	// like the red led of the v2 hardware, it is on by default without the app
+	Direction bool
+	// PullUp enables the pull-up resistor of inputs, chardev only, needs linux 5.5
+	PullUp bool
 }
 
-func (p *pin) Disable() {
-	_ = write(gpioPath(p.pin, "value"), "0")
-}
-
-func (p *pin) Flash() {
-	if err := p.Enable(); err != nil {
-		return
+func (p Pin) String() string {
+	s := strconv.Itoa(p.Line)
+	if p.ActiveLow {
+		s += ":low"
 	}
-
-	time.Sleep(flashDurr)
-	p.Disable()
-}
-
-func (p *pin) export() error {
-	path := base + "/gpio" + p.pin
-	if _, err := os.Stat(path); err == nil {
-		return nil // already exported
+	if p.Direction {
+		s += ":dir"
 	}
-
-	if err := write(base+"/export", p.pin); err != nil {
-		return fmt.Errorf("Failed to export: %v %v", p, err)
+	if p.PullUp {
+		s += ":up"
 	}
-
-	return nil
+	return s
 }
 
-func (p *pin) direction(d dir) error {
-	if err := write(gpioPath(p.pin, "direction"), string(d)); err != nil {
-		return fmt.Errorf("Failed to set direction 'out': %v %v", p, err)
+// ParsePin parses <line>[:low][:dir][:up], ex: 10:dir
+func ParsePin(s string) (Pin, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	line, err := strconv.Atoi(parts[0])
+	if err != nil || line < 0 {
+		return Pin{}, fmt.Errorf("invalid line: %q", s)
 	}
 
-	return nil
+	p := Pin{Line: line}
+	for _, flag := range parts[1:] {
+		switch flag {
+		case "low":
+			p.ActiveLow = true
+		case "dir":
+			p.Direction = true
+		case "up":
+			p.PullUp = true
+		default:
+			return Pin{}, fmt.Errorf("unknown flag %q: %q", flag, s)
+		}
+	}
+	return p, nil
 }
 
-// directionPin is always on, and is controlled by setting the GPIO direction instead
-type directionPin struct {
-	pin
+// Opts select the backend and the pins, see hardware.Profile
+type Opts struct {
+	// Backend is chardev or sysfs, empty means chardev if the chip exists, sysfs otherwise
+	Backend string
+	// Chip is the character device of the chip, ex: /dev/gpiochip0, gpiochip0 or 0
+	Chip string
+	// Pins are the pins by name: beeper, green, blue and red, the missing ones do nothing,
+	// sysfs takes the global numbers, they equal the lines of chips based at 0
+	Pins map[string]Pin
+	// Buttons are the input pins of the push buttons by name, see WatchButtons
+	Buttons map[string]Pin
+	// Debounce is how long a button has to be stable, LongPress is how long it has to be
+	// held for a long press, zero values mean the defaults
+	Debounce  time.Duration
+	LongPress time.Duration
 }
 
-func (p *directionPin) Enable() error {
-	return p.pin.direction(in)
+// backend requests the lines of the pins
+type backend interface {
+	open(name string, p Pin) (line, error)
+	// watch sends the current value of the input, then every change of it until ctx is done
+	watch(ctx context.Context, name string, p Pin) (<-chan bool, error)
 }
 
-func (p *directionPin) Disable() {
-	_ = p.pin.direction(out)
+// line is a requested line, it is set to the logical value, the backend handles active low
+type line interface {
+	set(on bool) error
 }
 
-type beepPin struct {
-	pin
+type pin struct {
+	mu   sync.Mutex
+	name string
+	cfg  Pin
+	line line
 }
 
-func (p *beepPin) StartupBeep() (err error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+func (p *pin) String() string {
+	return "GPIO PIN: " + p.name + " " + p.cfg.String()
+}
 
-	if err := p.Enable(); err != nil {
-		return err
+func (p *pin) Enable() error {
+	if p.line == nil {
+		return nil
 	}
-	<-time.After(beepDurr / 3)
-	p.Disable()
-	return
+	return p.line.set(true)
 }
 
-func (p *beepPin) SuccessBeep() (err error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	defer p.Disable()
-
-	if err := p.Enable(); err != nil {
-		return err
+func (p *pin) Disable() {
+	if p.line == nil {
+		return
+	}
+	if err := p.line.set(false); err != nil {
+		logger.Debugf("disabling %v failed: %v", p, err)
 	}
-	time.Sleep(beepDurr)
-	p.Disable()
-	return
 }
 
-func (p *beepPin) FailBeep() (err error) {
+type beepPin struct {
+	pin
+}
+
+// Play beeps for the tones, the beeper has a single tone, any non-zero frequency plays it
+func (p *beepPin) Play(ctx context.Context, tones []pattern.Tone) (err error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	defer p.Disable()
 
-	for i := 0; i < 4; i++ {
-		if err := p.Enable(); err != nil {
+	for _, t := range tones {
+		if t.Freq > 0 {
+			err = p.Enable()
+		} else {
+			p.Disable()
+		}
+		if err != nil {
+			return err
+		}
+		if err = pattern.Sleep(ctx, t.Durr); err != nil {
 			return err
 		}
-		time.Sleep(beepDurr / 2)
-		p.Disable()
-		time.Sleep(beepDurr / 2)
 	}
-
 	return
 }
 
 var (
-	Beeper   = beepPin{pin{pin: "20"}}
-	GreenLED = pin{pin: "8"}
-	BlueLED  = pin{pin: "9"}
-
-	// red pin is special! always on by default
-	RedLED = directionPin{pin{pin: "10"}}
+	Beeper   = beepPin{pin{name: "beeper"}}
+	GreenLED = pin{name: "green"}
+	BlueLED  = pin{name: "blue"}
+	RedLED   = pin{name: "red"}
 )
 
-func Setup() (err error) {
-	if err := Beeper.export(); err != nil {
-		return err
-	}
-	if err := Beeper.direction(out); err != nil {
-		return err
-	}
-	if err := GreenLED.export(); err != nil {
-		return err
-	}
-	if err := GreenLED.direction(out); err != nil {
-		return err
-	}
-	if err := BlueLED.export(); err != nil {
-		return err
-	}
-	if err := BlueLED.direction(out); err != nil {
-		return err
-	}
-	if err := RedLED.export(); err != nil {
-		return err
+func pins() map[string]*pin {
+	return map[string]*pin{
+		"beeper": &Beeper.pin,
+		"green":  &GreenLED,
+		"blue":   &BlueLED,
+		"red":    &RedLED,
 	}
-
-	return
-}
-
-func gpioPath(p string, file string) string {
-	return base + "/gpio" + p + "/" + file
 }
 
-func write(path, value string) error {
-	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+// Setup requests the lines of the pins
+func Setup(opts *Opts) error {
+	b, err := openBackend(opts)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	n, err := f.WriteString(value)
-	if err != nil {
-		return err
+	all := pins()
+	for name := range opts.Pins {
+		if _, ok := all[name]; !ok {
+			return fmt.Errorf("unknown pin: %v", name)
+		}
 	}
 
-	if n < len(value) {
-		return io.ErrShortWrite
+	for name, p := range all {
+		cfg, ok := opts.Pins[name]
+		if !ok {
+			continue
+		}
+
+		p.mu.Lock()
+		p.cfg = cfg
+		p.line, err = b.open(name, cfg)
+		p.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to request %v: %v", p, err)
+		}
 	}
 
 	return nil
 }
 
-func successFlash() (err error) {
-	GreenLED.Disable()
-	defer func() {
-		err = GreenLED.Enable()
-	}()
+func openBackend(opts *Opts) (backend, error) {
+	chip := opts.Chip
+	if chip == "" {
+		chip = "/dev/gpiochip0"
+	}
+	if _, err := strconv.Atoi(chip); err == nil {
+		chip = "gpiochip" + chip
+	}
+	if !strings.HasPrefix(chip, "/") {
+		chip = "/dev/" + chip
+	}
 
-	if err := BlueLED.Enable(); err != nil {
-		return err
+	switch opts.Backend {
+	case "chardev":
+		return openChip(chip)
+	case "sysfs":
+		return sysfs{}, nil
+	case "":
+		if _, err := os.Stat(chip); err != nil {
+			logger.Infof("no gpio chip at %v, falling back to sysfs: %v", chip, err)
+			return sysfs{}, nil
+		}
+		return openChip(chip)
+	default:
+		return nil, fmt.Errorf("unknown gpio backend: %v", opts.Backend)
 	}
-	time.Sleep(flashDurr)
-	BlueLED.Disable()
-	return
 }
 
-func failFlash() (err error) {
-	GreenLED.Disable()
-	defer func() {
-		err = GreenLED.Enable()
-	}()
-
-	// flash it 3 times
-	for i := 3; i > 0; i-- {
-		if err := RedLED.Enable(); err != nil {
-			return err
+// LEDs shows the states and the flashes on the leds, see leds.Manager
+var LEDs = leds.New(SetLEDs)
+
+// SetLEDs switches the leds on and the rest off
+func SetLEDs(leds pattern.LED) error {
+	var err error
+	set := func(p *pin, led pattern.LED) {
+		if leds&led == 0 {
+			p.Disable()
+		} else if e := p.Enable(); e != nil {
+			err = e
 		}
-		time.Sleep(flashDurr / 3)
-		RedLED.Disable()
-		time.Sleep(flashDurr / 3)
 	}
-	return
+
+	set(&GreenLED, pattern.Green)
+	set(&BlueLED, pattern.Blue)
+	set(&RedLED, pattern.Red)
+	return err
 }
 
-func Success(ctx context.Context) error {
-	g, _ := errgroup.WithContext(ctx)
-	g.Go(Beeper.SuccessBeep)
-	g.Go(successFlash)
-	return g.Wait()
+// Show flashes the lights, then leaves the rest on as the lowest state of LEDs
+func Show(ctx context.Context, lights []pattern.Light, rest pattern.LED) error {
+	LEDs.Set("rest", leds.Solid(0, rest))
+	return LEDs.Flash(ctx, leds.FlashPriority, lights)
 }
 
-func Fail(ctx context.Context) error {
+// Play plays the pattern on the beeper and the leds at the same time
+func Play(ctx context.Context, p pattern.Pattern) error {
 	g, _ := errgroup.WithContext(ctx)
-	g.Go(Beeper.FailBeep)
-	g.Go(failFlash)
+	g.Go(func() error {
+		return Beeper.Play(ctx, p.Tones)
+	})
+	g.Go(func() error {
+		return Show(ctx, p.Lights, p.Rest)
+	})
 	return g.Wait()
 }
@@ -0,0 +1,178 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sysfs is the deprecated /sys/class/gpio interface, removed from newer kernels
+type sysfs struct{}
+
+const base = "/sys/class/gpio"
+
+type sysfsLine struct {
+	num string
+	cfg Pin
+}
+
+func (sysfs) open(name string, p Pin) (line, error) {
+	l := &sysfsLine{num: strconv.Itoa(p.Line), cfg: p}
+	if err := l.export(); err != nil {
+		return nil, err
+	}
+
+	activeLow := "0"
+	if p.ActiveLow {
+		activeLow = "1"
+	}
+	if err := write(l.path("active_low"), activeLow); err != nil {
+		return nil, fmt.Errorf("failed to set active_low: %v", err)
+	}
+
+	if p.Direction {
+		// left as it is, direction pins are on by default
+		return l, nil
+	}
+	if err := l.direction("out"); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// pollInterval is how often the inputs are read, sysfs has no way to wait for an edge
+// without poll(2) on the value file
+const pollInterval = 10 * time.Millisecond
+
+func (sysfs) watch(ctx context.Context, name string, p Pin) (<-chan bool, error) {
+	l := &sysfsLine{num: strconv.Itoa(p.Line), cfg: p}
+	if err := l.export(); err != nil {
+		return nil, err
+	}
+	if p.PullUp {
+		logger.Warningf("sysfs cannot enable the pull-up of %v, use chardev or an external resistor", name)
+	}
+
+	activeLow := "0"
+	if p.ActiveLow {
+		activeLow = "1"
+	}
+	if err := write(l.path("active_low"), activeLow); err != nil {
+		return nil, fmt.Errorf("failed to set active_low: %v", err)
+	}
+	if err := l.direction("in"); err != nil {
+		return nil, err
+	}
+
+	level, err := l.value()
+	if err != nil {
+		return nil, err
+	}
+
+	levels := make(chan bool, 1)
+	levels <- level
+	go func() {
+		defer close(levels)
+		t := time.NewTicker(pollInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			v, err := l.value()
+			if err != nil {
+				logger.Errorf("reading %v failed: %v", name, err)
+				return
+			}
+			if v == level {
+				continue
+			}
+			level = v
+
+			select {
+			case <-ctx.Done():
+				return
+			case levels <- level:
+			}
+		}
+	}()
+	return levels, nil
+}
+
+func (l *sysfsLine) value() (bool, error) {
+	b, err := ioutil.ReadFile(l.path("value"))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(b)) == "1", nil
+}
+
+func (l *sysfsLine) set(on bool) error {
+	if l.cfg.Direction {
+		if on {
+			return l.direction("in")
+		}
+		// the direction is set with the raw value, active_low does not apply
+		if l.cfg.ActiveLow {
+			return l.direction("high")
+		}
+		return l.direction("low")
+	}
+
+	if on {
+		return write(l.path("value"), "1")
+	}
+	return write(l.path("value"), "0")
+}
+
+func (l *sysfsLine) export() error {
+	if _, err := os.Stat(base + "/gpio" + l.num); err == nil {
+		return nil // already exported
+	}
+
+	if err := write(base+"/export", l.num); err != nil {
+		return fmt.Errorf("failed to export: %v", err)
+	}
+
+	return nil
+}
+
+func (l *sysfsLine) direction(d string) error {
+	if err := write(l.path("direction"), d); err != nil {
+		return fmt.Errorf("failed to set direction %q: %v", d, err)
+	}
+
+	return nil
+}
+
+func (l *sysfsLine) path(file string) string {
+	return base + "/gpio" + l.num + "/" + file
+}
+
+func write(path, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := f.WriteString(value)
+	if err != nil {
+		return err
+	}
+
+	if n < len(value) {
+		return io.ErrShortWrite
+	}
+
+	return nil
+}
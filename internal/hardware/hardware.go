@@ -0,0 +1,218 @@
+// package hardware describes the devices the app runs on, the ones we built are
+// the built-in profiles, others are described in json files
+package hardware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/buzzer"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/config"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/display"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/gpio"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/power"
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("main.hardware")
+
+// Profile is the hardware of a device, the env vars of config override it
+type Profile struct {
+	// Name is shown on the about screen, ex: v2
+	Name string
+	// Board is the single board computer, ex: orangepi-pc-plus
+	Board string
+	// Feedback is the feedback driver, see feedback.Drivers
+	Feedback string
+	// GPIO is the beeper, the status leds and the buttons, nil if there are none
+	GPIO *gpio.Opts
+	// PWM is the pwm buzzer, nil if there is none
+	PWM *buzzer.Opts
+	// Display is the display on I²C or SPI
+	Display Display
+	// RTC is the real time clock on I²C, nil if there is none
+	RTC *RTC
+	// Power is the UPS HAT or the battery, nil if there is none
+	Power *power.Opts
+}
+
+// Display selects the display, empty values mean the defaults, see display.Opts
+type Display struct {
+	Driver string
+	Bus    string
+	Addr   uint16
+	DC     string
+}
+
+// RTC is a real time clock the kernel has a driver for
+type RTC struct {
+	// Driver is the name of the kernel driver, ex: ds3231
+	Driver string
+	// Bus is the number of the I²C adapter, ex: 0 for /sys/class/i2c-adapter/i2c-0
+	Bus  int
+	Addr uint16
+}
+
+// Profiles are the built-in profiles by name, the display is left to the default driver
+// of the platform, so development machines render into memory instead
+var Profiles = map[string]Profile{
+	"v1": {
+		Name:     "v1",
+		Board:    "orangepi-pc-plus",
+		Feedback: "buzzer",
+		PWM:      &buzzer.Opts{Chip: 0, Channel: 0},
+		RTC:      &RTC{Driver: "ds3231", Bus: 0, Addr: 0x68},
+	},
+	"v2": {
+		Name:     "v2",
+		Board:    "orangepi-pc-plus",
+		Feedback: "gpio",
+		GPIO: &gpio.Opts{
+			Chip: "/dev/gpiochip0",
+			Pins: map[string]gpio.Pin{
+				"beeper": {Line: 20},
+				"green":  {Line: 8},
+				"blue":   {Line: 9},
+				// always on by default, so it signals the app not running
+				"red": {Line: 10, Direction: true},
+			},
+		},
+		RTC: &RTC{Driver: "ds3231", Bus: 0, Addr: 0x68},
+	},
+}
+
+// Load returns the built-in profile by name or the one in the json file at the path,
+// ex: v2 or /barcode-scanner/hardware.json
+func Load(name string) (*Profile, error) {
+	if p, ok := Profiles[name]; ok {
+		return &p, nil
+	}
+	if !strings.Contains(name, "/") && filepath.Ext(name) != ".json" {
+		return nil, fmt.Errorf("unknown hardware profile: %v", name)
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Profile
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("failed parsing %v: %v", name, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(name), ".json")
+	}
+	return &p, nil
+}
+
+// GPIOOpts returns the gpio options of the profile with the configured ones applied
+func (p *Profile) GPIOOpts(cfg *config.Config) gpio.Opts {
+	var opts gpio.Opts
+	if p.GPIO != nil {
+		opts = *p.GPIO
+	}
+	if cfg.GPIOBackend != "" {
+		opts.Backend = cfg.GPIOBackend
+	}
+	if cfg.GPIOChip != "" {
+		opts.Chip = cfg.GPIOChip
+	}
+
+	opts.Pins = merge(opts.Pins, cfg.GPIOPins)
+	opts.Buttons = merge(opts.Buttons, cfg.GPIOButtons)
+	if cfg.ButtonLongPress > 0 {
+		opts.LongPress = cfg.ButtonLongPress
+	}
+	return opts
+}
+
+// merge returns the pins of both, b takes precedence
+func merge(a, b map[string]gpio.Pin) map[string]gpio.Pin {
+	ret := map[string]gpio.Pin{}
+	for name, pin := range a {
+		ret[name] = pin
+	}
+	for name, pin := range b {
+		ret[name] = pin
+	}
+	return ret
+}
+
+// BuzzerOpts returns the pwm of the profile, the first one of the first chip if it has none
+func (p *Profile) BuzzerOpts() buzzer.Opts {
+	if p.PWM == nil {
+		return buzzer.Opts{}
+	}
+	return *p.PWM
+}
+
+// DisplayOpts returns the display options of the profile with the configured ones applied
+func (p *Profile) DisplayOpts(cfg *config.Config) display.Opts {
+	opts := display.DefaultOpts
+	if p.Display.Driver != "" {
+		opts.Driver = p.Display.Driver
+	}
+	opts.Bus = p.Display.Bus
+	opts.Addr = p.Display.Addr
+	opts.DC = p.Display.DC
+
+	if cfg.DisplayDriver != "" {
+		opts.Driver = cfg.DisplayDriver
+	}
+	if cfg.DisplayBus != "" {
+		opts.Bus = cfg.DisplayBus
+	}
+	if cfg.DisplayAddress != 0 {
+		opts.Addr = cfg.DisplayAddress
+	}
+	if cfg.DisplayDCPin != "" {
+		opts.DC = cfg.DisplayDCPin
+	}
+	opts.Rotated = cfg.DisplayRotated
+	opts.Contrast = cfg.DisplayContrast
+	if cfg.DisplayCols > 0 {
+		opts.Cols, opts.Rows = cfg.DisplayCols, cfg.DisplayRows
+	}
+	return opts
+}
+
+// PowerOpts returns the power supply of the profile with the configured one applied
+func (p *Profile) PowerOpts(cfg *config.Config) power.Opts {
+	var opts power.Opts
+	if p.Power != nil {
+		opts = *p.Power
+	}
+	if cfg.PowerDriver != "" {
+		opts.Driver = cfg.PowerDriver
+	}
+	if cfg.PowerBus != "" {
+		opts.Bus = cfg.PowerBus
+	}
+	if cfg.PowerAddress != 0 {
+		opts.Addr = cfg.PowerAddress
+	}
+	return opts
+}
+
+// SetupRTC tells the kernel about the rtc of the profile unless it already knows it,
+// udev then syncs the system clock from it, see init/rtc-ds3231.rules
+func (p *Profile) SetupRTC() error {
+	if p.RTC == nil {
+		return nil
+	}
+
+	adapter := fmt.Sprintf("/sys/class/i2c-adapter/i2c-%d", p.RTC.Bus)
+	dev := fmt.Sprintf("%v/%d-%04x", adapter, p.RTC.Bus, p.RTC.Addr)
+	if _, err := os.Stat(dev); err == nil {
+		return nil
+	}
+
+	logger.Infof("registering rtc %v at %v", p.RTC.Driver, dev)
+	cmd := fmt.Sprintf("%v 0x%02x", p.RTC.Driver, p.RTC.Addr)
+	return ioutil.WriteFile(adapter+"/new_device", []byte(cmd), 0200)
+}
@@ -0,0 +1,203 @@
+// Package hd44780 drives HD44780 compatible character LCDs connected through
+// a PCF8574 based I²C backpack, the usual 16x2 and 20x4 modules.
+//
+// The backpack maps its 8 output pins as:
+// P0: RS, P1: RW, P2: E, P3: backlight, P4-P7: D4-D7
+// so the LCD is always used in 4-bit mode.
+package hd44780
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"periph.io/x/periph/conn/i2c"
+)
+
+const (
+	pinRS        = 0x01
+	pinE         = 0x04
+	pinBacklight = 0x08
+)
+
+const (
+	cmdClear       = 0x01
+	cmdEntryMode   = 0x06 // increment cursor, no shift
+	cmdDisplayOn   = 0x0C // display on, cursor off, blink off
+	cmdDisplayOff  = 0x08
+	cmdFunctionSet = 0x28 // 4-bit, 2 lines, 5x8 font
+	cmdSetDDRAM    = 0x80
+)
+
+// DefaultAddr is the factory address of most PCF8574 backpacks
+const DefaultAddr = 0x27
+
+// Dev is an open handle to the LCD
+type Dev struct {
+	mu        sync.Mutex
+	c         i2c.Dev
+	cols      int
+	rows      int
+	backlight byte
+	halted    bool
+	shown     []string
+}
+
+// NewI2C initializes the LCD behind the backpack at addr, cols and rows
+// have to match the physical module (16x2, 20x4, ...).
+func NewI2C(b i2c.Bus, addr uint16, cols, rows int) (*Dev, error) {
+	if cols <= 0 || rows <= 0 || rows > 4 {
+		return nil, errors.New("hd44780: invalid display size")
+	}
+
+	d := &Dev{
+		c:         i2c.Dev{Bus: b, Addr: addr},
+		cols:      cols,
+		rows:      rows,
+		backlight: pinBacklight,
+		shown:     make([]string, rows),
+	}
+
+	// initialization by instruction, see figure 24 of the datasheet:
+	// three times 8-bit mode to get into a known state, then switch to 4-bit
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := d.writeNibble(0x30, 0); err != nil {
+			return nil, err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := d.writeNibble(0x20, 0); err != nil {
+		return nil, err
+	}
+
+	for _, c := range []byte{cmdFunctionSet, cmdDisplayOn, cmdEntryMode, cmdClear} {
+		if err := d.command(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// Size returns the number of columns and rows of the display
+func (d *Dev) Size() (cols, rows int) {
+	return d.cols, d.rows
+}
+
+// WriteLines replaces the contents of the display, only the rows that changed
+// are rewritten since the I²C backpack is slow
+func (d *Dev) WriteLines(lines []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.halted {
+		if err := d.wake(); err != nil {
+			return err
+		}
+	}
+
+	for row := 0; row < d.rows; row++ {
+		text := ""
+		if row < len(lines) {
+			text = lines[row]
+		}
+		text = d.fit(text)
+		if text == d.shown[row] {
+			continue
+		}
+
+		if err := d.command(cmdSetDDRAM | d.rowOffset(row)); err != nil {
+			return err
+		}
+		for i := 0; i < len(text); i++ {
+			if err := d.data(text[i]); err != nil {
+				return err
+			}
+		}
+		d.shown[row] = text
+	}
+
+	return nil
+}
+
+// Halt switches the display and the backlight off,
+// the next WriteLines switches them back on
+func (d *Dev) Halt() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.backlight = 0
+	if err := d.command(cmdDisplayOff); err != nil {
+		return err
+	}
+	d.halted = true
+	return nil
+}
+
+func (d *Dev) wake() error {
+	d.backlight = pinBacklight
+	if err := d.command(cmdDisplayOn); err != nil {
+		return err
+	}
+	d.halted = false
+	return nil
+}
+
+// fit pads or cuts the text to exactly the width of the display,
+// anything outside of ASCII is not in the character ROM and is replaced
+func (d *Dev) fit(text string) string {
+	b := make([]byte, 0, d.cols)
+	for _, r := range text {
+		if len(b) == d.cols {
+			break
+		}
+		if r < ' ' || r > '}' {
+			r = '?'
+		}
+		b = append(b, byte(r))
+	}
+	for len(b) < d.cols {
+		b = append(b, ' ')
+	}
+
+	return string(b)
+}
+
+func (d *Dev) rowOffset(row int) byte {
+	// rows 2 and 3 are the continuation of rows 0 and 1 in memory
+	offsets := [4]byte{0x00, 0x40, byte(d.cols), 0x40 + byte(d.cols)}
+	return offsets[row]
+}
+
+func (d *Dev) command(c byte) error {
+	if err := d.write(c, 0); err != nil {
+		return err
+	}
+	// most commands need ~40µs to execute which the I²C transfer already covers,
+	// but clear needs 1.52ms
+	if c == cmdClear {
+		time.Sleep(2 * time.Millisecond)
+	}
+	return nil
+}
+
+func (d *Dev) data(c byte) error {
+	return d.write(c, pinRS)
+}
+
+func (d *Dev) write(c byte, mode byte) error {
+	if err := d.writeNibble(c&0xF0, mode); err != nil {
+		return err
+	}
+	return d.writeNibble((c<<4)&0xF0, mode)
+}
+
+// writeNibble clocks the upper 4 bits of n into the LCD by pulsing E
+func (d *Dev) writeNibble(n byte, mode byte) error {
+	b := n | mode | d.backlight
+	if err := d.c.Tx([]byte{b | pinE}, nil); err != nil {
+		return err
+	}
+	return d.c.Tx([]byte{b}, nil)
+}
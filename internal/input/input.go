@@ -0,0 +1,25 @@
+// package input has the devices the app reads keystrokes and scans from
+package input
+
+import (
+	"time"
+
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("main.input")
+
+// Source is a device the app reads keystrokes and scans from, ex: tty.TTY
+// the special keys are reported with the tty.Key* and tty.SpecialKey* runes, the end of a scan with '\n'
+type Source interface {
+	// ReadRune blocks until the next rune, io.EOF means the source is done for good
+	ReadRune() (r rune, size int, err error)
+	Close() error
+}
+
+// Timed is implemented by the sources knowing when their runes arrived from the device,
+// they are taken later while the app is busy, which would make typing look like a scan
+type Timed interface {
+	// ReadTime returns when the rune last returned by ReadRune arrived
+	ReadTime() time.Time
+}
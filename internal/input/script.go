@@ -0,0 +1,209 @@
+package input
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/tty"
+)
+
+// ScanDelay is the time between the runes of a scan, scanners are fast
+var ScanDelay = 2 * time.Millisecond
+
+// TypeDelay is the time between the runes typed by a human
+var TypeDelay = 120 * time.Millisecond
+
+// keys are the names of the special keys in scripts
+var keys = map[string]rune{
+	"esc":       tty.KeyEscape,
+	"enter":     '\n',
+	"up":        tty.KeyArrowUp,
+	"down":      tty.KeyArrowDown,
+	"left":      tty.KeyArrowLeft,
+	"right":     tty.KeyArrowRight,
+	"backspace": tty.KeyBackspace,
+	"delete":    tty.KeyDelete,
+	"home":      tty.SpecialKeyHome,
+	"end":       tty.SpecialKeyEnd,
+	"pageup":    tty.SpecialKeyPageUp,
+	"pagedown":  tty.SpecialKeyPageDown,
+	"f1":        tty.KeyF1,
+	"f2":        tty.KeyF2,
+}
+
+// Step is a line of a script, the commands are:
+//
+//	wait <duration>   pauses the replay, ex: wait 1.5s
+//	scan <text>       the text arrives like from a scanner, followed by enter
+//	type <text>       the text is typed like by a human, without enter
+//	key <name>        a special key: esc, enter, up, down, left, right, backspace, delete,
+//	                  home, end, pageup, pagedown, f1, f2
+//
+// empty lines and lines starting with # are skipped, every other command
+// is left to the caller of the Script, ex: assertions
+type Step struct {
+	Line int
+	Cmd  string
+	Arg  string
+}
+
+func (s Step) String() string {
+	return fmt.Sprintf("line %v: %v %v", s.Line, s.Cmd, s.Arg)
+}
+
+// ParseScript reads the steps of a script
+func ParseScript(r io.Reader) ([]Step, error) {
+	var ret []Step
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, " ", 2)
+		st := Step{Line: n, Cmd: parts[0]}
+		if len(parts) > 1 {
+			st.Arg = strings.TrimSpace(parts[1])
+		}
+
+		switch st.Cmd {
+		case "wait":
+			if _, err := time.ParseDuration(st.Arg); err != nil {
+				return nil, fmt.Errorf("%v: %v", st, err)
+			}
+		case "key":
+			if _, ok := keys[st.Arg]; !ok {
+				return nil, fmt.Errorf("%v: unknown key", st)
+			}
+		}
+		ret = append(ret, st)
+	}
+
+	return ret, sc.Err()
+}
+
+// Script is a Source replaying the keystrokes and scans of a script with their timing
+type Script struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	runes  chan timedRune
+	done   chan struct{}
+	err    error
+	// at is when the rune last read was sent
+	at time.Time
+}
+
+type timedRune struct {
+	r  rune
+	at time.Time
+}
+
+// NewScript starts replaying the steps, the commands not known by the Script
+// are handed to the hook in order, the replay stops at the first error of the hook
+func NewScript(ctx context.Context, steps []Step, hook func(Step) error) *Script {
+	ctx, cancel := context.WithCancel(ctx)
+	// the runes are buffered like by the devices, they are sent on time while the app is busy
+	s := &Script{
+		ctx:    ctx,
+		cancel: cancel,
+		runes:  make(chan timedRune, 64),
+		done:   make(chan struct{}),
+	}
+
+	go s.replay(steps, hook)
+	return s
+}
+
+func (s *Script) replay(steps []Step, hook func(Step) error) {
+	defer close(s.done)
+	defer close(s.runes)
+
+	for _, st := range steps {
+		var err error
+		switch st.Cmd {
+		case "wait":
+			d, _ := time.ParseDuration(st.Arg)
+			err = s.sleep(d)
+		case "scan":
+			err = s.send(st.Arg+"\n", ScanDelay)
+		case "type":
+			err = s.send(st.Arg, TypeDelay)
+		case "key":
+			err = s.send(string(keys[st.Arg]), 0)
+		default:
+			if hook == nil {
+				err = fmt.Errorf("unknown command")
+			} else {
+				err = hook(st)
+			}
+		}
+
+		if err != nil {
+			s.err = fmt.Errorf("%v: %v", st, err)
+			return
+		}
+		logger.Tracef("replayed %v", st)
+	}
+}
+
+func (s *Script) sleep(d time.Duration) error {
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+func (s *Script) send(text string, delay time.Duration) error {
+	for i, r := range text {
+		if i > 0 && delay > 0 {
+			if err := s.sleep(delay); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case s.runes <- timedRune{r, time.Now()}:
+		}
+	}
+	return nil
+}
+
+// ReadRune returns the next rune of the script, io.EOF after the last one
+func (s *Script) ReadRune() (rune, int, error) {
+	tr, ok := <-s.runes
+	if !ok {
+		return 0, 0, io.EOF
+	}
+	s.at = tr.at
+	return tr.r, 1, nil
+}
+
+// ReadTime returns when the rune last read was sent, like a device would
+func (s *Script) ReadTime() time.Time {
+	return s.at
+}
+
+// Close stops the replay
+func (s *Script) Close() error {
+	s.cancel()
+	return nil
+}
+
+// Done is closed when the replay is over
+func (s *Script) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the replay stopped early, valid after Done is closed
+func (s *Script) Err() error {
+	return s.err
+}
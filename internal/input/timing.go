@@ -0,0 +1,48 @@
+package input
+
+import (
+	"time"
+)
+
+// Timing tells scans from typing by the time between the runes of a line,
+// scanners send a whole barcode in a burst, humans are a lot slower
+type Timing struct {
+	// MaxGap is the longest pause between two runes of a scan
+	MaxGap time.Duration
+	// MaxAvgGap is the longest average pause between the runes of a scan,
+	// the whole line takes at most MaxAvgGap per rune
+	MaxAvgGap time.Duration
+}
+
+// DefaultTiming works with usb keyboard wedge scanners and 9600 baud serial ones
+var DefaultTiming = Timing{
+	MaxGap:    80 * time.Millisecond,
+	MaxAvgGap: 30 * time.Millisecond,
+}
+
+// Scanned returns whether the runes read at times, including the terminating
+// enter, look like a scan, lines of a single rune cannot be told apart,
+// a clock stepping back counts as no pause and a missing (zero) time as a long one
+func (t Timing) Scanned(times []time.Time) bool {
+	if len(times) < 2 {
+		return true
+	}
+
+	var total time.Duration
+	for i := 1; i < len(times); i++ {
+		if times[i].IsZero() || times[i-1].IsZero() {
+			return false
+		}
+
+		gap := times[i].Sub(times[i-1])
+		if gap < 0 {
+			gap = 0
+		}
+		if gap > t.MaxGap {
+			return false
+		}
+		total += gap
+	}
+
+	return total <= t.MaxAvgGap*time.Duration(len(times)-1)
+}
@@ -0,0 +1,72 @@
+package input
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScanned(t *testing.T) {
+	base := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+	timing := Timing{MaxGap: 80 * ms, MaxAvgGap: 30 * ms}
+
+	tests := []struct {
+		name string
+		// gaps are the pauses between the runes, the first one is read at base
+		gaps []time.Duration
+		want bool
+	}{
+		{"empty", nil, true},
+		{"single rune", []time.Duration{}, true},
+		{"burst", []time.Duration{5 * ms, 5 * ms, 5 * ms, 5 * ms}, true},
+		{"exactly max gap", []time.Duration{80 * ms, 0, 0, 0, 0}, true},
+		{"over max gap", []time.Duration{80*ms + 1, 0, 0, 0, 0}, false},
+		{"exactly max average", []time.Duration{30 * ms, 30 * ms, 30 * ms}, true},
+		{"over max average", []time.Duration{30 * ms, 30 * ms, 30*ms + 1}, false},
+		{"typing", []time.Duration{150 * ms, 120 * ms, 200 * ms}, false},
+		{"enter only", []time.Duration{10 * ms}, true},
+		{"slow enter", []time.Duration{200 * ms}, false},
+	}
+
+	for _, tt := range tests {
+		var times []time.Time
+		if tt.gaps != nil {
+			at := base
+			times = append(times, at)
+			for _, g := range tt.gaps {
+				at = at.Add(g)
+				times = append(times, at)
+			}
+		}
+
+		if got := timing.Scanned(times); got != tt.want {
+			t.Errorf("%v: Scanned = %v, expected %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScannedBadTimes(t *testing.T) {
+	base := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+
+	tests := []struct {
+		name  string
+		times []time.Time
+		want  bool
+	}{
+		{"single zero", []time.Time{{}}, true},
+		{"all zero", []time.Time{{}, {}, {}}, false},
+		{"zero first", []time.Time{{}, base, base.Add(5 * ms)}, false},
+		{"zero last", []time.Time{base, base.Add(5 * ms), {}}, false},
+		// the clock stepped back, the pause counts as none
+		{"unordered", []time.Time{base, base.Add(10 * ms), base.Add(-time.Hour), base.Add(-time.Hour + 10*ms)}, true},
+		{"unordered slow", []time.Time{base, base.Add(-time.Hour), base.Add(-time.Hour + 100*ms)}, false},
+		{"reversed", []time.Time{base.Add(20 * ms), base.Add(10 * ms), base}, true},
+	}
+
+	for _, tt := range tests {
+		if got := DefaultTiming.Scanned(tt.times); got != tt.want {
+			t.Errorf("%v: Scanned = %v, expected %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// package leds shows ongoing states and transient flashes on the status leds,
+// the state with the highest priority is shown, flashes interrupt the states below them
+package leds
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("main.leds")
+
+// FlashPriority is the priority of the flashes of the feedback patterns,
+// only the states above it hide them, the rest of the patterns is the state "rest" at 0
+const FlashPriority = 50
+
+// State is an ongoing indication, shown while it is set and nothing is above it
+type State struct {
+	Priority int
+	// Lights are repeated while the state is shown, a single light is solid
+	Lights []pattern.Light
+}
+
+func (s State) equal(o State) bool {
+	if s.Priority != o.Priority || len(s.Lights) != len(o.Lights) {
+		return false
+	}
+	for i := range s.Lights {
+		if s.Lights[i] != o.Lights[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Solid is a state showing the leds without blinking
+func Solid(priority int, leds pattern.LED) State {
+	return State{Priority: priority, Lights: []pattern.Light{{LEDs: leds, Durr: time.Second}}}
+}
+
+// Blink is a state alternating between the leds of on and off, every light for durr
+func Blink(priority int, on, off pattern.LED, durr time.Duration) State {
+	return State{Priority: priority, Lights: []pattern.Light{{LEDs: on, Durr: durr}, {LEDs: off, Durr: durr}}}
+}
+
+type flash struct {
+	priority int
+	lights   []pattern.Light
+	// done is closed once the flash is over or replaced
+	done chan struct{}
+}
+
+// Manager drives the leds with set, the leds are not touched until the first state or flash
+type Manager struct {
+	set func(leds pattern.LED) error
+
+	once    sync.Once
+	changed chan struct{}
+
+	mu     sync.Mutex
+	states map[string]State
+	flash  *flash
+}
+
+func New(set func(leds pattern.LED) error) *Manager {
+	return &Manager{
+		set:     set,
+		changed: make(chan struct{}, 1),
+		states:  map[string]State{},
+	}
+}
+
+// Set shows the state under the name until it is cleared, setting it again unchanged does nothing
+func (m *Manager) Set(name string, s State) {
+	m.mu.Lock()
+	if old, ok := m.states[name]; ok && old.equal(s) {
+		m.mu.Unlock()
+		return
+	}
+	m.states[name] = s
+	m.mu.Unlock()
+
+	m.notify()
+}
+
+// Clear removes the state
+func (m *Manager) Clear(name string) {
+	m.mu.Lock()
+	if _, ok := m.states[name]; !ok {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.states, name)
+	m.mu.Unlock()
+
+	m.notify()
+}
+
+// States returns the names of the states set in order
+func (m *Manager) States() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := make([]string, 0, len(m.states))
+	for name := range m.states {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Flash shows the lights once over the states below priority, then returns,
+// it returns early when ctx is done or another flash replaces it,
+// flashes under a state with a higher priority are skipped
+func (m *Manager) Flash(ctx context.Context, priority int, lights []pattern.Light) error {
+	if len(lights) == 0 {
+		return nil
+	}
+
+	f := &flash{priority: priority, lights: lights, done: make(chan struct{})}
+	m.mu.Lock()
+	if m.flash != nil {
+		close(m.flash.done)
+	}
+	m.flash = f
+	m.mu.Unlock()
+	m.notify()
+
+	select {
+	case <-ctx.Done():
+		m.endFlash(f)
+		return ctx.Err()
+	case <-f.done:
+		return nil
+	}
+}
+
+func (m *Manager) endFlash(f *flash) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.flash == f {
+		close(f.done)
+		m.flash = nil
+	}
+}
+
+func (m *Manager) notify() {
+	m.once.Do(func() {
+		go m.run()
+	})
+
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// top returns what to show: the flash if nothing is above it, otherwise the state
+// with the highest priority, nil for both if there is nothing
+func (m *Manager) top() (*flash, *State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var top *State
+	var topName string
+	for name, s := range m.states {
+		s := s
+		// ties are broken by name, so the same one is shown every time
+		if top == nil || s.Priority > top.Priority || (s.Priority == top.Priority && name < topName) {
+			top, topName = &s, name
+		}
+	}
+
+	if f := m.flash; f != nil {
+		if top == nil || f.priority >= top.Priority {
+			return f, nil
+		}
+		// hidden by the state
+		close(f.done)
+		m.flash = nil
+	}
+	return nil, top
+}
+
+// run shows the top until the app exits, the leds are only set when they change
+func (m *Manager) run() {
+	var shown pattern.LED
+	first := true
+	show := func(leds pattern.LED) {
+		if !first && leds == shown {
+			return
+		}
+		if err := m.set(leds); err != nil {
+			logger.Debugf("setting the leds failed: %v", err)
+			return
+		}
+		shown, first = leds, false
+	}
+
+	for {
+		f, s := m.top()
+		switch {
+		case f != nil:
+			// state changes wait for the flash, only a new flash interrupts it
+			showFlash(f, show)
+			m.endFlash(f)
+
+		case s != nil && len(s.Lights) == 1:
+			show(s.Lights[0].LEDs)
+			<-m.changed
+
+		case s != nil:
+			m.blink(s.Lights, show)
+
+		default:
+			// nothing to show, the leds are left as they are
+			<-m.changed
+		}
+	}
+}
+
+func showFlash(f *flash, show func(pattern.LED)) {
+	for _, l := range f.lights {
+		show(l.LEDs)
+		select {
+		case <-f.done:
+			return
+		case <-time.After(l.Durr):
+		}
+	}
+}
+
+// blink repeats the lights until anything changes
+func (m *Manager) blink(lights []pattern.Light, show func(pattern.LED)) {
+	t := time.NewTimer(0)
+	defer t.Stop()
+	<-t.C
+
+	for i := 0; ; i = (i + 1) % len(lights) {
+		show(lights[i].LEDs)
+		t.Reset(lights[i].Durr)
+		select {
+		case <-m.changed:
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package leds
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/pattern"
+)
+
+// recorder is a fake set function, it keeps every value the leds were set to
+type recorder struct {
+	mu   sync.Mutex
+	sets []pattern.LED
+}
+
+func (r *recorder) set(leds pattern.LED) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sets = append(r.sets, leds)
+	return nil
+}
+
+func (r *recorder) history() []pattern.LED {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]pattern.LED(nil), r.sets...)
+}
+
+// waitFor waits for the leds to be set to want
+func (r *recorder) waitFor(t *testing.T, want pattern.LED) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if h := r.history(); len(h) > 0 && h[len(h)-1] == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("leds were set to %v, expected %v last", r.history(), want)
+}
+
+func light(leds pattern.LED, d time.Duration) pattern.Light {
+	return pattern.Light{LEDs: leds, Durr: d}
+}
+
+func TestPriorities(t *testing.T) {
+	r := &recorder{}
+	m := New(r.set)
+
+	if len(r.history()) != 0 {
+		t.Fatalf("leds touched before the first state")
+	}
+
+	m.Set("low", Solid(10, pattern.Green))
+	r.waitFor(t, pattern.Green)
+	m.Set("high", Solid(30, pattern.Red))
+	r.waitFor(t, pattern.Red)
+	// below the one shown
+	m.Set("mid", Solid(20, pattern.Blue))
+	time.Sleep(10 * time.Millisecond)
+	r.waitFor(t, pattern.Red)
+
+	m.Clear("high")
+	r.waitFor(t, pattern.Blue)
+	m.Clear("mid")
+	r.waitFor(t, pattern.Green)
+
+	// ties are broken by name
+	m.Set("a", Solid(10, pattern.Red))
+	r.waitFor(t, pattern.Red)
+
+	if got, want := m.States(), []string{"a", "low"}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("states are %v, expected %v", got, want)
+	}
+}
+
+func TestSetUnchanged(t *testing.T) {
+	r := &recorder{}
+	m := New(r.set)
+
+	m.Set("low", Solid(10, pattern.Green))
+	r.waitFor(t, pattern.Green)
+	m.Set("low", Solid(10, pattern.Green))
+	m.Set("other", Solid(5, pattern.Green))
+	time.Sleep(20 * time.Millisecond)
+
+	if h := r.history(); len(h) != 1 {
+		t.Errorf("leds were set to %v, expected once", h)
+	}
+}
+
+func TestBlink(t *testing.T) {
+	r := &recorder{}
+	m := New(r.set)
+
+	m.Set("blink", Blink(10, pattern.Red, pattern.Blue, 10*time.Millisecond))
+	r.waitFor(t, pattern.Blue)
+	r.waitFor(t, pattern.Red)
+	r.waitFor(t, pattern.Blue)
+
+	m.Set("solid", Solid(20, pattern.Green))
+	r.waitFor(t, pattern.Green)
+	n := len(r.history())
+	time.Sleep(50 * time.Millisecond)
+	if h := r.history(); len(h) != n {
+		t.Errorf("still blinking under a solid state: %v", h[n:])
+	}
+}
+
+func TestFlashExpires(t *testing.T) {
+	r := &recorder{}
+	m := New(r.set)
+
+	m.Set("rest", Solid(0, pattern.Green))
+	r.waitFor(t, pattern.Green)
+
+	start := time.Now()
+	err := m.Flash(context.Background(), FlashPriority, []pattern.Light{
+		light(pattern.Blue, 20*time.Millisecond), light(0, 20*time.Millisecond),
+	})
+	if err != nil {
+		t.Fatalf("flash error: %v", err)
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("flash returned after %v, expected it to play for 40ms", d)
+	}
+
+	// the state is shown again once the flash is over
+	r.waitFor(t, pattern.Green)
+	want := []pattern.LED{pattern.Green, pattern.Blue, 0, pattern.Green}
+	if h := r.history(); len(h) != len(want) {
+		t.Errorf("leds were set to %v, expected %v", h, want)
+	}
+}
+
+func TestFlashHidden(t *testing.T) {
+	r := &recorder{}
+	m := New(r.set)
+
+	m.Set("battery", Solid(FlashPriority+1, pattern.Red))
+	r.waitFor(t, pattern.Red)
+
+	done := make(chan error)
+	go func() {
+		done <- m.Flash(context.Background(), FlashPriority, []pattern.Light{light(pattern.Blue, time.Second)})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("flash error: %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("a hidden flash is not skipped")
+	}
+
+	for _, l := range r.history() {
+		if l == pattern.Blue {
+			t.Errorf("hidden flash shown: %v", r.history())
+		}
+	}
+}
+
+func TestFlashReplaced(t *testing.T) {
+	r := &recorder{}
+	m := New(r.set)
+
+	first := make(chan error)
+	go func() {
+		first <- m.Flash(context.Background(), FlashPriority, []pattern.Light{light(pattern.Blue, time.Second)})
+	}()
+	r.waitFor(t, pattern.Blue)
+
+	second := make(chan error)
+	go func() {
+		second <- m.Flash(context.Background(), FlashPriority, []pattern.Light{light(pattern.Red, 20*time.Millisecond)})
+	}()
+	select {
+	case err := <-first:
+		if err != nil {
+			t.Errorf("replaced flash error: %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("the replaced flash did not return")
+	}
+	r.waitFor(t, pattern.Red)
+	if err := <-second; err != nil {
+		t.Errorf("flash error: %v", err)
+	}
+}
+
+func TestFlashCancelled(t *testing.T) {
+	r := &recorder{}
+	m := New(r.set)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- m.Flash(ctx, FlashPriority, []pattern.Light{light(pattern.Blue, time.Second)})
+	}()
+	r.waitFor(t, pattern.Blue)
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("cancelled flash returned %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("the cancelled flash did not return")
+	}
+
+	// a state set afterwards is shown right away
+	m.Set("rest", Solid(0, pattern.Green))
+	r.waitFor(t, pattern.Green)
+}
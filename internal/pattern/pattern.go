@@ -0,0 +1,140 @@
+// package pattern describes what the buzzer and the leds do as data, see feedback.Patterns
+package pattern
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tone is a step of the buzzer
+type Tone struct {
+	// Freq is in Hz, zero is silence
+	Freq int
+	Durr time.Duration
+	// Volume is a percent of the loudest, zero means the loudest,
+	// only the pwm buzzer can play it, see ParseTones
+	Volume int
+}
+
+// LED is a set of leds
+type LED uint8
+
+const (
+	Green LED = 1 << iota
+	Blue
+	Red
+)
+
+// Light is a step of the leds
+type Light struct {
+	// LEDs are the leds switched on, the rest are off
+	LEDs LED
+	Durr time.Duration
+}
+
+// Pattern is played on the buzzer and the leds at the same time
+type Pattern struct {
+	Name   string
+	Tones  []Tone
+	Lights []Light
+	// Rest are the leds left on after the pattern
+	Rest LED
+}
+
+// Sleep waits for durr, it returns early with the error of the context when it is done
+func Sleep(ctx context.Context, durr time.Duration) error {
+	t := time.NewTimer(durr)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// notes are the semitones of the note names from c
+var notes = map[byte]int{'c': 0, 'd': 2, 'e': 4, 'f': 5, 'g': 7, 'a': 9, 'b': 11}
+
+// ParseTones parses a space separated list of <tone>:<duration>[@<volume>], the tone is
+// a note with an octave (ex: c6, f#5), a frequency in Hz or r for a rest,
+// the duration is a go duration and the volume is a percent of the loudest,
+// ex: c6:80ms e6:80ms r:40ms 2068:150ms@50
+func ParseTones(s string) ([]Tone, error) {
+	var ret []Tone
+	for _, tok := range strings.Fields(s) {
+		var t Tone
+		parts := strings.SplitN(tok, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("missing duration: %q", tok)
+		}
+
+		durr := parts[1]
+		if i := strings.IndexByte(durr, '@'); i >= 0 {
+			v, err := strconv.Atoi(durr[i+1:])
+			if err != nil || v < 1 || v > 100 {
+				return nil, fmt.Errorf("invalid volume: %q", tok)
+			}
+			t.Volume = v
+			durr = durr[:i]
+		}
+
+		d, err := time.ParseDuration(durr)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid duration: %q", tok)
+		}
+		t.Durr = d
+
+		if t.Freq, err = parseFreq(parts[0]); err != nil {
+			return nil, fmt.Errorf("invalid tone: %q", tok)
+		}
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
+
+// MustParseTones is ParseTones for the built-in patterns, it panics on errors
+func MustParseTones(s string) []Tone {
+	ret, err := ParseTones(s)
+	if err != nil {
+		panic("pattern: " + err.Error())
+	}
+	return ret
+}
+
+func parseFreq(s string) (int, error) {
+	s = strings.ToLower(s)
+	if s == "r" {
+		return 0, nil
+	}
+	if f, err := strconv.Atoi(s); err == nil && f > 0 {
+		return f, nil
+	}
+
+	// note, optional sharp, octave: a4 is 440Hz
+	if len(s) < 2 {
+		return 0, errors.New("invalid note")
+	}
+	n, ok := notes[s[0]]
+	if !ok {
+		return 0, errors.New("invalid note")
+	}
+	oct := s[1:]
+	if oct[0] == '#' {
+		n++
+		oct = oct[1:]
+	}
+	o, err := strconv.Atoi(oct)
+	if err != nil || o < 0 || o > 9 {
+		return 0, errors.New("invalid octave")
+	}
+
+	semitones := o*12 + n - (4*12 + 9)
+	return int(math.Round(440 * math.Pow(2, float64(semitones)/12))), nil
+}
@@ -0,0 +1,50 @@
+package pattern
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTones(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []Tone
+		err  bool
+	}{
+		{"", nil, false},
+		{"a4:100ms", []Tone{{Freq: 440, Durr: 100 * time.Millisecond}}, false},
+		{"C6:80ms f#5:1s", []Tone{{Freq: 1047, Durr: 80 * time.Millisecond}, {Freq: 740, Durr: time.Second}}, false},
+		{"r:40ms 2068:150ms@50", []Tone{{Durr: 40 * time.Millisecond}, {Freq: 2068, Durr: 150 * time.Millisecond, Volume: 50}}, false},
+		{"g5:30ms@1 g5:30ms@100", []Tone{{Freq: 784, Durr: 30 * time.Millisecond, Volume: 1}, {Freq: 784, Durr: 30 * time.Millisecond, Volume: 100}}, false},
+		// bad notes
+		{"h4:100ms", nil, true},
+		{"c:100ms", nil, true},
+		{"c#:100ms", nil, true},
+		{"c10:100ms", nil, true},
+		{"-440:100ms", nil, true},
+		{"0:100ms", nil, true},
+		// missing or bad durations
+		{"a4", nil, true},
+		{"a4:", nil, true},
+		{"a4:100", nil, true},
+		{"a4:-1s", nil, true},
+		{"a4:100ms r", nil, true},
+		// out of range volumes
+		{"a4:100ms@0", nil, true},
+		{"a4:100ms@101", nil, true},
+		{"a4:100ms@", nil, true},
+		{"a4:100ms@loud", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTones(tt.s)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseTones(%q) error: %v", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTones(%q) = %+v, expected %+v", tt.s, got, tt.want)
+		}
+	}
+}
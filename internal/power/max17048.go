@@ -0,0 +1,87 @@
+package power
+
+import (
+	"fmt"
+
+	"periph.io/x/periph/conn/i2c"
+	"periph.io/x/periph/conn/i2c/i2creg"
+	"periph.io/x/periph/host"
+)
+
+// the registers of the max17048 fuel gauge, they are 16 bit big endian
+const (
+	max17048Addr    = 0x36
+	max17048SOC     = 0x04
+	max17048Version = 0x08
+	max17048CRate   = 0x16
+)
+
+// max17048DischargeRate is the charge rate in %/hr under which the battery is discharging,
+// the gauge knows nothing about the external power, but the battery is charged or full
+// while it is plugged in, so only a discharging battery means being on battery
+const max17048DischargeRate = -2.0
+
+// max17048 is the fuel gauge of most UPS HATs, ex: the Geekworm X728
+type max17048 struct {
+	dev *i2c.Dev
+}
+
+func openMAX17048(opts *Opts) (Source, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, err
+	}
+
+	b, err := i2creg.Open(opts.Bus)
+	if err != nil {
+		return nil, fmt.Errorf("could not open i2c bus: %v", err)
+	}
+
+	addr := opts.Addr
+	if addr == 0 {
+		addr = max17048Addr
+	}
+	g := &max17048{dev: &i2c.Dev{Bus: b, Addr: addr}}
+
+	// the version is 0x001_, it makes sure the gauge is there
+	v, err := g.read(max17048Version)
+	if err != nil {
+		_ = b.Close()
+		return nil, fmt.Errorf("no max17048 at 0x%02x: %v", addr, err)
+	}
+	logger.Debugf("max17048 version: 0x%04x", v)
+	return g, nil
+}
+
+func (g *max17048) Read() (State, error) {
+	st := State{Battery: -1}
+	soc, err := g.read(max17048SOC)
+	if err != nil {
+		return st, err
+	}
+	rate, err := g.read(max17048CRate)
+	if err != nil {
+		return st, err
+	}
+
+	// the high byte is the percent, the low byte is 1/256 percent,
+	// a full battery reads a little over 100
+	st.Battery = int(soc >> 8)
+	if soc&0xFF >= 0x80 {
+		st.Battery++
+	}
+	if st.Battery > 100 {
+		st.Battery = 100
+	}
+
+	// signed, 0.208%/hr per bit
+	st.OnBattery = float64(int16(rate))*0.208 < max17048DischargeRate
+	return st, nil
+}
+
+func (g *max17048) read(reg byte) (uint16, error) {
+	var buf [2]byte
+	if err := g.dev.Tx([]byte{reg}, buf[:]); err != nil {
+		return 0, err
+	}
+	return uint16(buf[0])<<8 | uint16(buf[1]), nil
+}
@@ -0,0 +1,70 @@
+// package power reads the battery of a UPS HAT or a battery gauge, so the app can
+// shut down cleanly before the battery runs out
+package power
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("main.power")
+
+// State is the state of the power supply
+type State struct {
+	// Battery is the charge in percent, negative if unknown
+	Battery int
+	// OnBattery is set when the external power is lost
+	OnBattery bool
+}
+
+// Opts selects and configures the power driver
+type Opts struct {
+	// Driver is the name of a driver, see Drivers
+	Driver string
+	// Bus is the periph name of the I²C bus of gauges, empty means the first one found
+	Bus string
+	// Addr is the I²C address of gauges, zero means the default of the driver
+	Addr uint16
+}
+
+// Source reads the state of the power supply
+type Source interface {
+	Read() (State, error)
+}
+
+// Drivers open the Source by driver name
+var Drivers = map[string]func(opts *Opts) (Source, error){
+	"sysfs":    openSysfs,
+	"max17048": openMAX17048,
+}
+
+// Open returns the source of the driver of opts, nil if the driver is empty or none
+func Open(opts *Opts) (Source, error) {
+	if opts.Driver == "" || opts.Driver == "none" {
+		return nil, nil
+	}
+
+	open, ok := Drivers[opts.Driver]
+	if !ok {
+		names := make([]string, 0, len(Drivers))
+		for name := range Drivers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown power driver: %v, expected one of %v", opts.Driver, names)
+	}
+	return open(opts)
+}
+
+// Off powers the machine off cleanly, systemd stops the services first, the app included
+func Off() error {
+	logger.Warningf("powering off")
+	out, err := exec.Command("systemctl", "poweroff").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl poweroff failed: %v, output: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package power
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// supplyPath lists the power supplies the kernel has drivers for,
+// ex: the ac, usb and battery of an axp20x pmic
+var supplyPath = "/sys/class/power_supply"
+
+// sysfs reads the battery and the external supplies of the kernel drivers
+type sysfs struct {
+	// battery is the directory of the first battery, empty if there is none
+	battery string
+	// external are the directories of the mains and usb supplies
+	external []string
+}
+
+func openSysfs(*Opts) (Source, error) {
+	dirs, err := ioutil.ReadDir(supplyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sysfs{}
+	for _, d := range dirs {
+		dir := filepath.Join(supplyPath, d.Name())
+		typ, err := readString(dir, "type")
+		if err != nil {
+			logger.Debugf("skipping power supply %v: %v", d.Name(), err)
+			continue
+		}
+
+		switch typ {
+		case "Battery", "UPS":
+			if s.battery == "" {
+				s.battery = dir
+			}
+		case "Mains", "USB":
+			s.external = append(s.external, dir)
+		}
+	}
+
+	if s.battery == "" && len(s.external) == 0 {
+		return nil, errors.New("no power supply found in " + supplyPath)
+	}
+	logger.Debugf("power supplies: battery %q, external %v", s.battery, s.external)
+	return s, nil
+}
+
+// Read is on battery when every external supply is offline, without any
+// when the battery is discharging
+func (s *sysfs) Read() (State, error) {
+	st := State{Battery: -1}
+	status := ""
+	if s.battery != "" {
+		c, err := readString(s.battery, "capacity")
+		if err != nil {
+			return st, err
+		}
+		if st.Battery, err = strconv.Atoi(c); err != nil {
+			return st, err
+		}
+		// missing on some drivers
+		status, _ = readString(s.battery, "status")
+	}
+
+	if len(s.external) == 0 {
+		st.OnBattery = status == "Discharging"
+		return st, nil
+	}
+
+	st.OnBattery = true
+	for _, dir := range s.external {
+		online, err := readString(dir, "online")
+		if err != nil {
+			return st, err
+		}
+		if online == "1" {
+			st.OnBattery = false
+		}
+	}
+	return st, nil
+}
+
+func readString(dir, file string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,20 @@
+package serial
+
+// Opts configure the port and the framing of the scans
+type Opts struct {
+	// Path of the port, glob patterns select the first match, ex: /dev/ttyACM*
+	Path string
+	Baud int
+	// Framing is <data bits><parity: N, E or O><stop bits>, ex: 8N1
+	Framing string
+	// Terminator ends a scan, empty means either CR or LF
+	Terminator string
+	// Prefix and Suffix are stripped from the scans if present
+	Prefix, Suffix string
+}
+
+var DefaultOpts = Opts{
+	Path:    "/dev/ttyACM*",
+	Baud:    9600,
+	Framing: "8N1",
+}
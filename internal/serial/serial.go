@@ -0,0 +1,292 @@
+// +build linux
+
+// package serial reads barcode scanners in USB-CDC or RS-232 mode, the scans arrive as lines
+// in the encoding of the scanner, independent of any keyboard layout
+package serial
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/juju/loggo"
+)
+
+var logger = loggo.GetLogger("main.serial")
+
+// RetryInterval is the time between looking for the port when it is not plugged in
+var RetryInterval = 1 * time.Second
+
+var ErrNoPort = errors.New("no matching serial port")
+
+// from asm-generic/termbits.h, missing from syscall
+const (
+	cbaud   = 0x100f
+	crtscts = 0x80000000
+)
+
+var bauds = map[int]uint32{
+	1200:   syscall.B1200,
+	2400:   syscall.B2400,
+	4800:   syscall.B4800,
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+	230400: syscall.B230400,
+}
+
+// Port reads the scans of a serial scanner, it implements input.Source,
+// the scans are returned rune by rune, followed by '\n'
+// when it is unplugged, ReadRune waits for it to be plugged in again
+type Port struct {
+	ctx   context.Context
+	opts  Opts
+	cflag uint32
+
+	// mu protects f, Send can be called from any goroutine
+	mu     sync.Mutex
+	f      *os.File
+	reader *bufio.Reader
+	// pending are the runes of the current scan not returned yet
+	pending []rune
+	// at is when the current scan was read
+	at time.Time
+}
+
+// Open returns a Port reading the first port matching opts.Path,
+// it is fine if the scanner is not plugged in yet
+func Open(ctx context.Context, opts Opts) (*Port, error) {
+	cflag, err := framing(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Port{
+		ctx:   ctx,
+		opts:  opts,
+		cflag: cflag,
+	}
+	if err := p.open(); err != nil && err != ErrNoPort {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// framing returns the control flags of the termios for the baud rate and the framing
+func framing(opts Opts) (uint32, error) {
+	speed, ok := bauds[opts.Baud]
+	if !ok {
+		return 0, fmt.Errorf("unsupported baud rate: %v", opts.Baud)
+	}
+
+	var bits, stop int
+	var parity byte
+	if _, err := fmt.Sscanf(opts.Framing, "%1d%c%1d", &bits, &parity, &stop); err != nil {
+		return 0, fmt.Errorf("invalid framing %q: %v", opts.Framing, err)
+	}
+
+	cflag := speed | syscall.CREAD | syscall.CLOCAL
+	switch bits {
+	case 7:
+		cflag |= syscall.CS7
+	case 8:
+		cflag |= syscall.CS8
+	default:
+		return 0, fmt.Errorf("unsupported data bits: %v", bits)
+	}
+	switch parity {
+	case 'N':
+	case 'E':
+		cflag |= syscall.PARENB
+	case 'O':
+		cflag |= syscall.PARENB | syscall.PARODD
+	default:
+		return 0, fmt.Errorf("unsupported parity: %c", parity)
+	}
+	switch stop {
+	case 1:
+	case 2:
+		cflag |= syscall.CSTOPB
+	default:
+		return 0, fmt.Errorf("unsupported stop bits: %v", stop)
+	}
+
+	return cflag, nil
+}
+
+func (p *Port) open() error {
+	paths, err := filepath.Glob(p.opts.Path)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return ErrNoPort
+	}
+
+	f, err := os.OpenFile(paths[0], os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return err
+	}
+
+	// raw mode, reads block until at least a byte arrives
+	term := syscall.Termios{
+		Cflag: p.cflag,
+	}
+	term.Cflag &^= crtscts
+	term.Cc[syscall.VMIN] = 1
+	term.Cc[syscall.VTIME] = 0
+	term.Ispeed = p.cflag & cbaud
+	term.Ospeed = p.cflag & cbaud
+	if _, _, err := syscall.Syscall6(syscall.SYS_IOCTL, f.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&term)), 0, 0, 0); err != 0 {
+		_ = f.Close()
+		return fmt.Errorf("setting up %v failed: %v", paths[0], err)
+	}
+
+	p.mu.Lock()
+	p.f = f
+	p.mu.Unlock()
+	p.reader = bufio.NewReader(f)
+	logger.Infof("reading input from %v (%v baud, %v)", paths[0], p.opts.Baud, p.opts.Framing)
+	return nil
+}
+
+// ReadRune returns the next rune of the current scan, reading the next one when needed
+func (p *Port) ReadRune() (rune, int, error) {
+	for len(p.pending) == 0 {
+		if p.ctx.Err() != nil {
+			return '\n', 1, nil
+		}
+
+		line, err := p.readScan()
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		p.pending = append([]rune(string(line)), '\n')
+		p.at = time.Now()
+	}
+
+	r := p.pending[0]
+	p.pending = p.pending[1:]
+	return r, 1, nil
+}
+
+// ReadTime returns when the scan of the rune last returned by ReadRune was read,
+// the runes of a scan arrive together
+func (p *Port) ReadTime() time.Time {
+	return p.at
+}
+
+// readScan returns the next scan without the terminator, prefix and suffix
+func (p *Port) readScan() ([]byte, error) {
+	for {
+		if p.reader == nil {
+			if err := p.open(); err != nil {
+				if err != ErrNoPort {
+					logger.Warningf("open failed: %v", err)
+				}
+
+				select {
+				case <-p.ctx.Done():
+					return nil, nil
+				case <-time.After(RetryInterval):
+				}
+				continue
+			}
+		}
+
+		line, err := p.readLine()
+		if err != nil {
+			// most likely unplugged
+			logger.Warningf("serial port lost: %v", err)
+			p.close()
+			continue
+		}
+
+		line = bytes.TrimPrefix(line, []byte(p.opts.Prefix))
+		line = bytes.TrimSuffix(line, []byte(p.opts.Suffix))
+		return dropControl(line), nil
+	}
+}
+
+// dropControl removes the control bytes, ex: the separators of ISO/IEC 15434 payloads
+// in 2D shipping labels, they are not part of the barcode and the app takes some for keys
+func dropControl(line []byte) []byte {
+	ret := line[:0]
+	for _, b := range line {
+		if b >= 0x20 && b != 0x7f {
+			ret = append(ret, b)
+		}
+	}
+	return ret
+}
+
+func (p *Port) readLine() ([]byte, error) {
+	if p.opts.Terminator == "" {
+		// either CR or LF, CRLF gives an empty line which is skipped
+		var line []byte
+		for {
+			b, err := p.reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if b == '\r' || b == '\n' {
+				return line, nil
+			}
+			line = append(line, b)
+		}
+	}
+
+	term := []byte(p.opts.Terminator)
+	var line []byte
+	for !bytes.HasSuffix(line, term) {
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+	return line[:len(line)-len(term)], nil
+}
+
+// Send writes a command to the scanner, ex: to beep or to switch its leds
+func (p *Port) Send(cmd string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.f == nil {
+		return ErrNoPort
+	}
+	_, err := p.f.Write([]byte(cmd))
+	return err
+}
+
+func (p *Port) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.f != nil {
+		_ = p.f.Close()
+	}
+	p.f = nil
+	p.reader = nil
+}
+
+// Close releases the port
+func (p *Port) Close() error {
+	p.close()
+	return nil
+}
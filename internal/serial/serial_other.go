@@ -0,0 +1,27 @@
+// +build !linux
+
+package serial
+
+import (
+	"context"
+	"errors"
+)
+
+type Port struct {
+}
+
+func Open(ctx context.Context, opts Opts) (*Port, error) {
+	return nil, errors.New("unimplemented")
+}
+
+func (p *Port) ReadRune() (rune, int, error) {
+	return 0, 0, errors.New("unimplemented")
+}
+
+func (p *Port) Send(cmd string) error {
+	return errors.New("unimplemented")
+}
+
+func (p *Port) Close() error {
+	return nil
+}
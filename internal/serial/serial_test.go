@@ -0,0 +1,23 @@
+// +build linux
+
+package serial
+
+import (
+	"testing"
+)
+
+func TestDropControl(t *testing.T) {
+	tests := map[string]string{
+		"1Z999AA10123456784":                "1Z999AA10123456784",
+		"[)>\x1e01\x1d02840\x1d001\x1e\x04": "[)>0102840001",
+		"\x04":                              "",
+		"ÁRVÍZ\x7f":                         "ÁRVÍZ",
+		"tab\tsep":                          "tabsep",
+	}
+
+	for in, want := range tests {
+		if got := string(dropControl([]byte(in))); got != want {
+			t.Errorf("dropControl(%q) = %q, expected %q", in, got, want)
+		}
+	}
+}
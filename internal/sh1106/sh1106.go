@@ -259,6 +259,16 @@ func (d *Dev) Halt() error {
 	return err
 }
 
+// Wake turns the display back on after Halt.
+//
+// Draw only re-enables the display when the frame changed.
+func (d *Dev) Wake() error {
+	if !d.halted {
+		return nil
+	}
+	return d.sendCommand(nil)
+}
+
 // Invert the display (black on white vs white on black).
 func (d *Dev) Invert(blackOnWhite bool) error {
 	b := []byte{0xA6}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Memory keeps the Barcodes in memory only, it is used when replaying scripts
+type Memory struct {
+	mu         sync.Mutex
+	rows       []Barcode
+	lastInsert time.Time
+	pending    int
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Insert stores the Barcode, it never fails
+func (m *Memory) Insert(data Barcode) {
+	if data.CreatedAt.IsZero() {
+		panic("Barcode.CreatedAt cannot be zero")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rows = append(m.rows, data)
+	m.lastInsert = time.Now()
+}
+
+// Rows returns the inserted Barcodes in order
+func (m *Memory) Rows() []Barcode {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Barcode(nil), m.rows...)
+}
+
+func (m *Memory) LastInsert() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.lastInsert
+}
+
+// Pending is zero unless set, there is nothing to wait for
+func (m *Memory) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pending
+}
+
+// SetPending pretends that n scans are waiting for the database
+func (m *Memory) SetPending(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending = n
+}
+
+func (m *Memory) FreeSpace() (float64, error) {
+	return 100, nil
+}
+
+// Flush waits for the pending scans set by SetPending to be gone, like the database
+// being down, an error means some are still pending
+func (m *Memory) Flush(ctx context.Context) error {
+	t := time.NewTicker(10 * time.Millisecond)
+	defer t.Stop()
+
+	for {
+		n := m.Pending()
+		if n == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v barcodes are still pending", n)
+		case <-t.C:
+		}
+	}
+}
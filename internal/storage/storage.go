@@ -6,14 +6,17 @@ import (
 	"crypto/sha1"
 	"database/sql"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/config"
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/currier"
 	"code.sztanpet.net/zvpsz/barcode-scanner/internal/file"
 	"github.com/go-sql-driver/mysql"
 	"github.com/juju/loggo"
@@ -26,13 +29,17 @@ type Storage struct {
 	dsn    string
 	db     *sql.DB
 	insert chan inData
+	flush  chan flushReq
 
 	stmtMu   sync.RWMutex
 	inStmt   *sql.Stmt
 	deviceid uint64
 
-	bufMu sync.Mutex
-	inBuf map[[20]byte]Barcode
+	bufMu      sync.Mutex
+	inBuf      map[[20]byte]Barcode
+	lastInsert time.Time
+	// pending counts the barcodes not inserted yet, persisted or only buffered
+	pending int
 }
 
 type inData struct {
@@ -40,11 +47,21 @@ type inData struct {
 	data Barcode
 }
 
+// flushReq asks consumeData to insert everything pending until ctx is done, then close done
+type flushReq struct {
+	ctx  context.Context
+	done chan struct{}
+}
+
 // Barcode represents the data to tbe inserted
 type Barcode struct {
 	Barcode        string
 	Direction      string
 	CurrierService string
+	Operator       string // badge ID of the logged in operator, empty if nobody is
+	Source         string // id of the input the barcode was read from
+	Manual         bool   // typed by hand instead of scanned, confirmed by the operator
+	Undo           bool   // cancels the last row of the same barcode, rows are never deleted
 	CreatedAt      time.Time
 }
 
@@ -74,13 +91,21 @@ func New(ctx context.Context, cfg *config.Config) (*Storage, error) {
 		return nil, err
 	}
 
+	// the barcodes persisted before the restart, counted once here instead of on every Pending
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Storage{
-		ctx:    ctx,
-		path:   path,
-		dsn:    cfg.DatabaseDSN,
-		db:     db,
-		inBuf:  map[[20]byte]Barcode{},
-		insert: make(chan inData, 1),
+		ctx:     ctx,
+		path:    path,
+		dsn:     cfg.DatabaseDSN,
+		db:      db,
+		inBuf:   map[[20]byte]Barcode{},
+		insert:  make(chan inData, 1),
+		flush:   make(chan flushReq),
+		pending: len(files),
 	}
 
 	go s.consumeData()
@@ -127,6 +152,7 @@ func (s *Storage) Insert(data Barcode) {
 		panic("duplicate index found, assumption does not hold")
 	}
 	s.inBuf[ix] = data
+	s.pending++
 	s.bufMu.Unlock()
 
 	// try to send the data up to the DB asap, on success the serialized file will be deleted
@@ -158,38 +184,17 @@ func (s *Storage) consumeData() {
 			return
 
 		case in := <-s.insert:
-			err := s.dbInsert(in.data)
-
-			// if the database insert was successfull, we can safely remove the local backup of the data
-			if err == nil {
-				err = os.Remove(in.path)
-				if err != nil {
-					// not doing anything more than logging the error will not cause trouble
-					// since there is a unique index on barcode.createdat, so on re-inserting
-					// we should just try and remove the file again
-					//
-					// the same data can be sent multiple times because:
-					//  - new barcode, gets persisted, gets buffered, tries to be inserted BUT
-					//    there is no internet, insertion failes, the data remains persisted and buffered
-					//  - internet comes back
-					//  - buffer handling runs, inserts data, removes persisted file
-					//  - persisted file handling runs at near the same time, reads persisted data
-					//    inserts (but unique index ignores it)
-					//    tries to remove persisted file, but buffer handling already removed it
-					logger.Debugf("Failed to remove path: %v error was: %v", in.path, err)
-				}
-
-				// delete from in-memory buffer of barcodes
-				s.bufMu.Lock()
-				ix := sha1.Sum([]byte(in.path))
-				delete(s.inBuf, ix)
-				s.bufMu.Unlock()
-
-				logger.Tracef("inserted barcode: %v", in.path)
-			} else {
-				// otherwise just ignore the error, processPath and processBuf will retry the insert later
-				logger.Debugf("dbInsert error: %v", err)
+			s.consume(in)
+
+		case req := <-s.flush:
+			// the regular processing would send the same rows again
+			if cancel != nil {
+				cancel()
+				cancel = nil
 			}
+			s.flushPending(req.ctx)
+			close(req.done)
+
 		case <-t.C:
 			if cancel != nil {
 				cancel()
@@ -205,6 +210,127 @@ func (s *Storage) consumeData() {
 	}
 }
 
+// consume inserts the data into the database, then removes its persisted and buffered copies
+func (s *Storage) consume(in inData) {
+	err := s.dbInsert(in.data)
+
+	// if the database insert was successfull, we can safely remove the local backup of the data
+	if err == nil {
+		err = os.Remove(in.path)
+		removed := err == nil
+		if err != nil {
+			// not doing anything more than logging the error will not cause trouble
+			// since there is a unique index on barcode.createdat, so on re-inserting
+			// we should just try and remove the file again
+			//
+			// the same data can be sent multiple times because:
+			//  - new barcode, gets persisted, gets buffered, tries to be inserted BUT
+			//    there is no internet, insertion failes, the data remains persisted and buffered
+			//  - internet comes back
+			//  - buffer handling runs, inserts data, removes persisted file
+			//  - persisted file handling runs at near the same time, reads persisted data
+			//    inserts (but unique index ignores it)
+			//    tries to remove persisted file, but buffer handling already removed it
+			logger.Debugf("Failed to remove path: %v error was: %v", in.path, err)
+		}
+
+		// delete from in-memory buffer of barcodes
+		s.bufMu.Lock()
+		ix := sha1.Sum([]byte(in.path))
+		_, buffered := s.inBuf[ix]
+		delete(s.inBuf, ix)
+		// the same barcode is only counted once, even when it is sent again
+		if (removed || buffered) && s.pending > 0 {
+			s.pending--
+		}
+		s.lastInsert = time.Now()
+		s.bufMu.Unlock()
+
+		logger.Tracef("inserted barcode: %v", in.path)
+	} else {
+		// otherwise just ignore the error, processPath and processBuf will retry the insert later
+		logger.Debugf("dbInsert error: %v", err)
+	}
+}
+
+// flushPending tries inserting every buffered and persisted barcode once, oldest first
+func (s *Storage) flushPending(ctx context.Context) {
+	pending := map[string]Barcode{}
+	s.bufMu.Lock()
+	for _, data := range s.inBuf {
+		pending[s.pathForBarcode(data)] = data
+	}
+	s.bufMu.Unlock()
+
+	files, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		logger.Errorf("listing s.path failed (%v), flushing the buffer only", err)
+	}
+	for _, f := range files {
+		path := filepath.Join(s.path, f.Name())
+		if _, ok := pending[path]; ok {
+			continue
+		}
+
+		var data Barcode
+		if err := file.Unserialize(path, &data); err != nil {
+			logger.Errorf("failed unseralizing %v, error was: %v", path, err)
+			continue
+		}
+		pending[path] = data
+	}
+
+	// the file names are the creation times
+	paths := make([]string, 0, len(pending))
+	for path := range pending {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return
+		}
+		s.consume(inData{path: path, data: pending[path]})
+	}
+}
+
+// LastInsert returns when a barcode was last inserted into the database successfully,
+// zero if not since startup
+func (s *Storage) LastInsert() time.Time {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+
+	return s.lastInsert
+}
+
+// Pending returns the number of barcodes not yet inserted into the database
+func (s *Storage) Pending() int {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+
+	return s.pending
+}
+
+// Flush has the consumer try inserting every pending barcode once, giving up when ctx is done,
+// then syncs the filesystem, so the persisted ones survive losing the power,
+// an error means some are still pending
+func (s *Storage) Flush(ctx context.Context) error {
+	req := flushReq{ctx: ctx, done: make(chan struct{})}
+	select {
+	case <-ctx.Done():
+	case <-s.ctx.Done():
+	case s.flush <- req:
+		<-req.done
+	}
+
+	syncFS()
+
+	if n := s.Pending(); n > 0 {
+		return fmt.Errorf("%v barcodes are still pending", n)
+	}
+	return nil
+}
+
 func (s *Storage) processBuf(ctx context.Context) {
 	s.bufMu.Lock()
 	now := time.Now()
@@ -290,6 +416,10 @@ func (s *Storage) dbInsert(row Barcode) error {
 		row.Barcode,
 		row.Direction,
 		row.CurrierService,
+		sql.NullString{String: row.Operator, Valid: row.Operator != ""},
+		sql.NullString{String: row.Source, Valid: row.Source != ""},
+		row.Manual,
+		row.Undo,
 		row.CreatedAt.UnixNano(),
 	)
 
@@ -334,8 +464,8 @@ func (s *Storage) ensureStatement() error {
 	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
 	defer cancel()
 	stmt, err := s.db.PrepareContext(ctx, `
-		INSERT INTO barcodes (deviceid, barcode, direction, currier_service, created_at, timestamp)
-		VALUES (?, ?, ?, ?, ?, NOW())
+		INSERT INTO barcodes (deviceid, barcode, direction, currier_service, operator, source, manual, undo, created_at, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())
 	`)
 	if err != nil {
 		return err
@@ -422,3 +552,32 @@ func (s *Storage) SetupDevice(cfg *config.Config) (did uint64, err error) {
 	s.deviceid = did
 	return did, err
 }
+
+// Curriers loads the currier services from the curriers table, it is a currier.Source
+func (s *Storage) Curriers(ctx context.Context) ([]currier.Currier, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, pattern, active
+		FROM curriers
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []currier.Currier
+	for rows.Next() {
+		var c currier.Currier
+		var pattern sql.NullString
+		if err := rows.Scan(&c.ID, &c.Name, &pattern, &c.Active); err != nil {
+			return nil, err
+		}
+		c.Pattern = pattern.String
+		ret = append(ret, c)
+	}
+
+	return ret, rows.Err()
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"code.sztanpet.net/zvpsz/barcode-scanner/internal/config"
+)
+
+func TestPending(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// persisted before the restart
+	if err := os.MkdirAll(filepath.Join(dir, "storage"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"1", "2"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, "storage", name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := New(ctx, &config.Config{StatePath: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Pending(); n != 2 {
+		t.Fatalf("pending = %v after the restart, expected 2", n)
+	}
+
+	// without a device id nothing reaches the database
+	s.Insert(Barcode{Barcode: "1234", CreatedAt: time.Now()})
+	s.Insert(Barcode{Barcode: "5678", CreatedAt: time.Now().Add(time.Millisecond)})
+	if n := s.Pending(); n != 4 {
+		t.Fatalf("pending = %v after inserting, expected 4", n)
+	}
+}
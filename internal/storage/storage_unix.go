@@ -0,0 +1,20 @@
+// +build !windows
+
+package storage
+
+import "syscall"
+
+// FreeSpace returns the free space in percent on the filesystem the barcodes are persisted to
+func (s *Storage) FreeSpace() (float64, error) {
+	fs := syscall.Statfs_t{}
+	if err := syscall.Statfs(s.path, &fs); err != nil {
+		return 0, err
+	}
+
+	return float64(fs.Bavail) / float64(fs.Blocks) * 100, nil
+}
+
+// syncFS syncs the filesystems, the files are synced when persisted, their directory entries are not
+func syncFS() {
+	syscall.Sync()
+}
@@ -0,0 +1,14 @@
+// +build windows
+
+package storage
+
+import "errors"
+
+// FreeSpace is only implemented on unix, the devices run linux
+func (s *Storage) FreeSpace() (float64, error) {
+	return 0, errors.New("unimplemented")
+}
+
+// syncFS does nothing, the files are synced when persisted
+func syncFS() {
+}
@@ -111,7 +111,7 @@ func (t *Bot) Send(txt string, disableNotification bool) (err error) {
 				frag,
 				' ',
 				'(',
-				[]byte(string(48 + i))[0], // ascii 0 + i = "i"
+				byte(48+i), // ascii 0 + i = "i"
 				')',
 			)
 			i++
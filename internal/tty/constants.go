@@ -19,3 +19,22 @@ const (
 	SpecialKeyDelete   = '\x12'
 	ignoreKey          = '\000'
 )
+
+// keys without a control character, from the private use area of unicode
+const (
+	SpecialKeyInsert = '\ue000' + iota
+	SpecialKeyPageUp
+	SpecialKeyPageDown
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+)
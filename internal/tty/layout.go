@@ -0,0 +1,104 @@
+package tty
+
+import (
+	"sort"
+)
+
+// key codes from linux/input-event-codes.h used by the layouts
+const (
+	keySpace     = 57
+	key102nd     = 86
+	keyGrave     = 41
+	keyBackslash = 43
+)
+
+// Layout maps the linux key codes to the runes they produce: plain, with shift and with AltGr,
+// zero means the combination produces nothing
+type Layout map[uint16][3]rune
+
+// Layouts are the supported keyboard layouts by name, the scanners are configured
+// to one of them, see Remap and evdev.Open
+var Layouts = map[string]Layout{
+	"us": newLayout(
+		row{2, "1234567890-=", "!@#$%^&*()_+", ""},
+		row{16, "qwertyuiop[]", "QWERTYUIOP{}", ""},
+		row{30, "asdfghjkl;'`", "ASDFGHJKL:\"~", ""},
+		row{43, "\\zxcvbnm,./", "|ZXCVBNM<>?", ""},
+	),
+	"de": newLayout(
+		row{2, "1234567890ß´", "!\"§$%&/()=?`", "\x00²³\x00\x00\x00{[]}\\\x00"},
+		row{16, "qwertzuiopü+", "QWERTZUIOPÜ*", "@\x00€\x00\x00\x00\x00\x00\x00\x00\x00~"},
+		row{30, "asdfghjklöä^", "ASDFGHJKLÖÄ°", ""},
+		row{43, "#yxcvbnm,.-", "'YXCVBNM;:_", "\x00\x00\x00\x00\x00\x00\x00µ"},
+		row{key102nd, "<", ">", "|"},
+	),
+	"hu": newLayout(
+		row{keyGrave, "0", "§", ""},
+		row{2, "123456789öüó", "'\"+!%/=()ÖÜÓ", "~ˇ^˘°˛`˙´˝¨¸"},
+		row{16, "qwertzuiopőú", "QWERTZUIOPŐÚ", "\\|Ä\x00\x00\x00€Í\x00\x00÷×"},
+		row{30, "asdfghjkléá", "ASDFGHJKLÉÁ", "äđĐ[]\x00íłŁ$ß"},
+		row{keyBackslash, "űyxcvbnm,.-", "ŰYXCVBNM?:_", "¤>#&@{}\x00;>*"},
+		row{key102nd, "í", "Í", "<"},
+	),
+}
+
+// row is a row of keys with consecutive codes starting at code
+type row struct {
+	code                uint16
+	plain, shift, altgr string
+}
+
+func newLayout(rows ...row) Layout {
+	l := Layout{
+		keySpace: {' ', ' ', ' '},
+	}
+	for _, r := range rows {
+		plain, shift, altgr := []rune(r.plain), []rune(r.shift), []rune(r.altgr)
+		for i := range plain {
+			k := [3]rune{plain[i]}
+			if i < len(shift) {
+				k[1] = shift[i]
+			}
+			if i < len(altgr) {
+				k[2] = altgr[i]
+			}
+			l[r.code+uint16(i)] = k
+		}
+	}
+
+	// the numeric keypad is the same everywhere
+	for code, r := range map[uint16]rune{
+		71: '7', 72: '8', 73: '9', 74: '-', 75: '4', 76: '5', 77: '6', 78: '+',
+		79: '1', 80: '2', 81: '3', 82: '0', 83: '.', 55: '*', 98: '/',
+	} {
+		l[code] = [3]rune{r, r, 0}
+	}
+
+	return l
+}
+
+// LayoutNames returns the names of the supported layouts
+func LayoutNames() []string {
+	ret := make([]string, 0, len(Layouts))
+	for name := range Layouts {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// layoutRemap returns what the runes read through a console with the console layout
+// are on a scanner configured to the scanner layout, only the differing ones are kept
+func layoutRemap(console, scanner Layout) map[rune]rune {
+	ret := map[rune]rune{}
+	for code, keys := range console {
+		for i, r := range keys {
+			sr := scanner[code][i]
+			if r == 0 || sr == 0 || r == sr {
+				continue
+			}
+			ret[r] = sr
+		}
+	}
+	return ret
+}
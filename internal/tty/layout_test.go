@@ -0,0 +1,52 @@
+package tty
+
+import (
+	"testing"
+)
+
+func TestLayoutRemap(t *testing.T) {
+	tests := []struct {
+		console, scanner string
+		r                rune
+		want             rune
+	}{
+		// z and y are swapped on de and hu
+		{"us", "de", 'z', 'y'},
+		{"us", "de", 'y', 'z'},
+		{"us", "de", '-', 'ß'},
+		{"us", "de", '/', '-'},
+		{"us", "de", '@', '"'},
+		{"de", "us", 'y', 'z'},
+		{"de", "us", 'ß', '-'},
+		{"de", "us", '#', '\\'},
+		{"us", "hu", 'z', 'y'},
+		{"us", "hu", '0', 'ö'},
+		{"us", "hu", '`', '0'},
+		{"hu", "us", 'ö', '0'},
+		{"hu", "us", 'é', ';'},
+		// altgr
+		{"de", "hu", '@', '\\'},
+		{"hu", "de", '€', '\x00'},
+		// the same on both, or missing from the scanner layout
+		{"us", "de", 'a', '\x00'},
+		{"us", "de", '1', '\x00'},
+		{"us", "hu", ' ', '\x00'},
+		{"hu", "us", 'í', '\x00'},
+		{"us", "us", 'z', '\x00'},
+	}
+
+	for _, tt := range tests {
+		m := layoutRemap(Layouts[tt.console], Layouts[tt.scanner])
+		if got := m[tt.r]; got != tt.want {
+			t.Errorf("%v to %v: %q is %q, expected %q", tt.console, tt.scanner, tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestLayoutRemapSame(t *testing.T) {
+	for _, name := range LayoutNames() {
+		if m := layoutRemap(Layouts[name], Layouts[name]); len(m) != 0 {
+			t.Errorf("%v to itself remaps %v runes", name, len(m))
+		}
+	}
+}
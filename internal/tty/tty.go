@@ -7,44 +7,100 @@ package tty
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"errors"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
+	"unicode/utf8"
 	"unsafe"
 )
 
 var ErrUnknownEscapeSequence = errors.New("ErrUnknownEscapeSequence")
 
+// EscapeTimeout is how long the rest of an escape sequence is waited for,
+// an escape without anything following it in time is the escape key
+var EscapeTimeout = 50 * time.Millisecond
+
+var errTimeout = errors.New("timeout")
+
+// bracketed paste mode, the terminal wraps pasted text in escape sequences
+const (
+	pasteOn  = "\033[?2004h"
+	pasteOff = "\033[?2004l"
+)
+
 type TTY struct {
-	ctx    context.Context
-	in     *os.File
-	reader *bufio.Reader
-	buf    bytes.Buffer
-	term   syscall.Termios
+	ctx   context.Context
+	in    *os.File
+	term  syscall.Termios
+	runes chan readResult
+	// pending are the runes read ahead while decoding a sequence
+	pending []readResult
+	// at is when the last rune taken by the decoder was read
+	at time.Time
+	// paste is true between the start and the end of a bracketed paste
+	paste bool
+	// remap translates the runes of scanners configured to a different layout, see Remap
+	remap map[rune]rune
+}
+
+type readResult struct {
+	r   rune
+	at  time.Time
+	err error
 }
 
+// readAhead is how many runes are read while the app is busy, so they are read on time
+const readAhead = 256
+
 func Open(ctx context.Context) (*TTY, error) {
-	in, err := os.Open("/dev/tty")
+	in, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
 	if err != nil {
 		return nil, err
 	}
 
 	t := &TTY{
-		ctx:    ctx,
-		in:     in,
-		reader: bufio.NewReader(in),
+		ctx:   ctx,
+		in:    in,
+		runes: make(chan readResult, readAhead),
 	}
 
 	err = t.disableEcho()
 	if err != nil {
 		return nil, err
 	}
+	_, _ = in.WriteString(pasteOn)
 
+	go t.read()
 	return t, nil
 }
 
+// Remap translates the runes from scanners configured to the scanner layout,
+// when the console uses the console layout, ex: z and y are swapped for de on us
+func (t *TTY) Remap(console, scanner Layout) {
+	t.remap = layoutRemap(console, scanner)
+}
+
+// read reads the runes in the background, so the decoder can wait for them with a timeout
+func (t *TTY) read() {
+	reader := bufio.NewReader(t.in)
+	for {
+		r, _, err := reader.ReadRune()
+		select {
+		case <-t.ctx.Done():
+			return
+		case t.runes <- readResult{r, time.Now(), err}:
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
 // For reading runes we just want to disable echo.
 func (t *TTY) disableEcho() error {
 	if _, _, err := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(t.in.Fd()), syscall.TCGETS, uintptr(unsafe.Pointer(&t.term)), 0, 0, 0); err != 0 {
@@ -65,72 +121,213 @@ func (t *TTY) RestoreTermMode() {
 	_, _, _ = syscall.Syscall6(syscall.SYS_IOCTL, uintptr(t.in.Fd()), syscall.TCSETS, uintptr(unsafe.Pointer(&t.term)), 0, 0, 0)
 }
 
-func (t *TTY) Buffered() bool {
-	return t.reader.Buffered() > 0
+// next returns the next rune, waiting at most timeout for it if it is not zero
+func (t *TTY) next(timeout time.Duration) (rune, error) {
+	if len(t.pending) > 0 {
+		res := t.pending[0]
+		t.pending = t.pending[1:]
+		t.at = res.at
+		return res.r, nil
+	}
+
+	var after <-chan time.Time
+	if timeout > 0 {
+		tm := time.NewTimer(timeout)
+		defer tm.Stop()
+		after = tm.C
+	}
+
+	select {
+	case <-t.ctx.Done():
+		return 0, io.EOF
+	case <-after:
+		return 0, errTimeout
+	case res := <-t.runes:
+		t.at = res.at
+		return res.r, res.err
+	}
+}
+
+// unread returns the rune to the input, it is read again next
+func (t *TTY) unread(r rune) {
+	t.pending = append(t.pending, readResult{r: r, at: t.at})
 }
 
+// ReadRune returns the next key, the special keys are decoded from their
+// escape sequences and reported with the Key* and SpecialKey* runes
 func (t *TTY) ReadRune() (r rune, size int, err error) {
 	for {
-		select {
-		case <-t.ctx.Done():
-			return '\n', 1, nil
-		default:
+		r, err = t.next(0)
+		if err != nil {
+			return r, 0, err
 		}
 
-		r, size, err = t.reader.ReadRune()
-		if err != nil {
-			return r, size, err
+		if r == KeyEscape {
+			r, err = t.escape()
+			if err != nil {
+				return r, 1, err
+			}
+		} else if r2, ok := t.remap[r]; ok && !t.paste {
+			// pasted text is in the layout of the console already
+			r = r2
 		}
 
-		// parse escape sequences
-		if r == '\033' {
+		if r != ignoreKey {
+			break
+		}
+	}
 
-			// not buffered anything? just a pure escape
-			if !t.Buffered() {
-				return KeyEscape, 1, nil
-			}
+	return r, utf8.RuneLen(r), nil
+}
 
-			r, size, err = t.reader.ReadRune()
-			if err != nil {
-				return r, size, err
-			}
+// ReadTime returns when the last rune of the key returned by ReadRune was read
+func (t *TTY) ReadTime() time.Time {
+	return t.at
+}
 
-			// no support for alt+ combinations
-			if r != '[' {
-				return r, size, ErrUnknownEscapeSequence
-			}
+// escape decodes the escape sequence started by an escape
+func (t *TTY) escape() (rune, error) {
+	r, err := t.next(EscapeTimeout)
+	if err == errTimeout {
+		// nothing followed, just a pure escape
+		return KeyEscape, nil
+	}
+	if err != nil {
+		return 0, err
+	}
 
-			r, size, err = t.reader.ReadRune()
-			if err != nil {
-				return r, size, err
-			}
+	switch r {
+	case '[':
+		return t.csi()
+	case 'O':
+		return t.ss3()
+	case KeyEscape:
+		// the second one may start a sequence
+		t.unread(r)
+		return KeyEscape, nil
+	}
 
-			switch r {
-			case 'D':
-				return KeyArrowLeft, 1, nil
-			case 'C':
-				return KeyArrowRight, 1, nil
-			case 'A':
-				return KeyArrowUp, 1, nil
-			case 'B':
-				return KeyArrowDown, 1, nil
-			case '3': // Delete Button
-				// discard the following '~' key from buffer
-				_, _, _ = t.reader.ReadRune()
-				return SpecialKeyDelete, 1, nil
-			default:
-				if t.Buffered() {
-					// still a '~' in the buffer, discard
-					_, _, _ = t.reader.ReadRune()
-				}
-				return r, size, ErrUnknownEscapeSequence
+	// no support for alt+ combinations, the key itself is kept
+	t.unread(r)
+	return ignoreKey, ErrUnknownEscapeSequence
+}
+
+// csi decodes the rest of an ESC [ sequence: parameters, intermediates and a final byte
+func (t *TTY) csi() (rune, error) {
+	var params []rune
+	for {
+		r, err := t.next(EscapeTimeout)
+		if err == errTimeout {
+			return ignoreKey, ErrUnknownEscapeSequence
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case r == '[' && len(params) == 0:
+			// the linux console sends ESC [ [ A-E for F1-F5
+			r, err = t.next(EscapeTimeout)
+			if err != nil || r < 'A' || r > 'E' {
+				return ignoreKey, ErrUnknownEscapeSequence
 			}
+			return KeyF1 + (r - 'A'), nil
+		case r >= 0x20 && r <= 0x3f:
+			params = append(params, r)
+		case r >= 0x40 && r <= 0x7e:
+			return t.csiKey(string(params), r)
+		default:
+			// not part of a sequence, keep it
+			t.unread(r)
+			return ignoreKey, ErrUnknownEscapeSequence
 		}
+	}
+}
 
-		if r != ignoreKey {
+// csiKeys are the ESC [ <n> ~ sequences by n
+var csiKeys = map[int]rune{
+	1: SpecialKeyHome, 2: SpecialKeyInsert, 3: SpecialKeyDelete, 4: SpecialKeyEnd,
+	5: SpecialKeyPageUp, 6: SpecialKeyPageDown, 7: SpecialKeyHome, 8: SpecialKeyEnd,
+	11: KeyF1, 12: KeyF2, 13: KeyF3, 14: KeyF4, 15: KeyF5,
+	17: KeyF6, 18: KeyF7, 19: KeyF8, 20: KeyF9, 21: KeyF10, 23: KeyF11, 24: KeyF12,
+}
+
+// csiKey returns the key of a complete ESC [ sequence, the modifiers
+// like in ESC [ 1 ; 5 A are ignored
+func (t *TTY) csiKey(params string, final rune) (rune, error) {
+	switch final {
+	case 'A':
+		return KeyArrowUp, nil
+	case 'B':
+		return KeyArrowDown, nil
+	case 'C':
+		return KeyArrowRight, nil
+	case 'D':
+		return KeyArrowLeft, nil
+	case 'H':
+		return SpecialKeyHome, nil
+	case 'F':
+		return SpecialKeyEnd, nil
+	case 'P', 'Q', 'R', 'S':
+		return KeyF1 + (final - 'P'), nil
+	case '~':
+		n, err := strconv.Atoi(strings.SplitN(params, ";", 2)[0])
+		if err != nil {
 			break
 		}
+
+		switch n {
+		case 200:
+			t.paste = true
+			return ignoreKey, nil
+		case 201:
+			t.paste = false
+			return ignoreKey, nil
+		}
+		if r, ok := csiKeys[n]; ok {
+			return r, nil
+		}
+	}
+
+	return ignoreKey, ErrUnknownEscapeSequence
+}
+
+// ss3 decodes the rest of an ESC O sequence, sent by terminals in application mode
+func (t *TTY) ss3() (rune, error) {
+	r, err := t.next(EscapeTimeout)
+	if err == errTimeout {
+		return ignoreKey, ErrUnknownEscapeSequence
+	}
+	if err != nil {
+		return 0, err
 	}
 
-	return r, size, nil
+	switch r {
+	case 'A':
+		return KeyArrowUp, nil
+	case 'B':
+		return KeyArrowDown, nil
+	case 'C':
+		return KeyArrowRight, nil
+	case 'D':
+		return KeyArrowLeft, nil
+	case 'H':
+		return SpecialKeyHome, nil
+	case 'F':
+		return SpecialKeyEnd, nil
+	case 'M':
+		// enter on the numeric keypad
+		return '\n', nil
+	case 'P', 'Q', 'R', 'S':
+		return KeyF1 + (r - 'P'), nil
+	}
+
+	return ignoreKey, ErrUnknownEscapeSequence
+}
+
+// Close restores the terminal and closes it
+func (t *TTY) Close() error {
+	_, _ = t.in.WriteString(pasteOff)
+	t.RestoreTermMode()
+	return t.in.Close()
 }
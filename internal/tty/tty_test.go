@@ -0,0 +1,89 @@
+// +build !windows
+// +build !plan9
+
+package tty
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// unknown marks an ErrUnknownEscapeSequence in the keys read
+const unknown = -1
+
+func TestReadRune(t *testing.T) {
+	tests := []struct {
+		name string
+		// in are sent one after the other with a pause longer than EscapeTimeout between them
+		in    []string
+		remap bool
+		want  []rune
+	}{
+		{"plain", []string{"ab1\n"}, false, []rune{'a', 'b', '1', '\n'}},
+		{"csi arrows", []string{"\x1b[A\x1b[B\x1b[C\x1b[D"}, false, []rune{KeyArrowUp, KeyArrowDown, KeyArrowRight, KeyArrowLeft}},
+		{"csi modifiers", []string{"\x1b[1;5A\x1b[1;2P"}, false, []rune{KeyArrowUp, KeyF1}},
+		{"csi home end", []string{"\x1b[H\x1b[F\x1b[1~\x1b[4~"}, false, []rune{SpecialKeyHome, SpecialKeyEnd, SpecialKeyHome, SpecialKeyEnd}},
+		{"csi tilde", []string{"\x1b[2~\x1b[3~\x1b[5~\x1b[6~"}, false, []rune{SpecialKeyInsert, SpecialKeyDelete, SpecialKeyPageUp, SpecialKeyPageDown}},
+		{"csi function keys", []string{"\x1b[11~\x1b[15~\x1b[17~\x1b[24~"}, false, []rune{KeyF1, KeyF5, KeyF6, KeyF12}},
+		{"csi unknown", []string{"\x1b[99~x\x1b[Zy"}, false, []rune{unknown, 'x', unknown, 'y'}},
+		{"csi broken", []string{"\x1b[\n"}, false, []rune{unknown, '\n'}},
+		{"csi timeout", []string{"\x1b[", "A"}, false, []rune{unknown, 'A'}},
+		{"ss3", []string{"\x1bOA\x1bOH\x1bOP\x1bOS\x1bOM"}, false, []rune{KeyArrowUp, SpecialKeyHome, KeyF1, KeyF4, '\n'}},
+		{"ss3 unknown", []string{"\x1bOzx"}, false, []rune{unknown, 'x'}},
+		{"linux console function keys", []string{"\x1b[[A\x1b[[C\x1b[[E"}, false, []rune{KeyF1, KeyF3, KeyF5}},
+		{"linux console unknown", []string{"\x1b[[Zx"}, false, []rune{unknown, 'x'}},
+		{"alt", []string{"\x1bx"}, false, []rune{unknown, 'x'}},
+		{"lone escape", []string{"\x1b", "a"}, false, []rune{KeyEscape, 'a'}},
+		{"double escape", []string{"\x1b\x1b[A"}, false, []rune{KeyEscape, KeyArrowUp}},
+		{"remap", []string{"zy-"}, true, []rune{'y', 'z', 'ß'}},
+		{"paste", []string{"z\x1b[200~zy\x1b[201~z"}, true, []rune{'y', 'z', 'y', 'y'}},
+		{"paste with escape", []string{"\x1b[200~z\x1bz\x1b[201~z"}, true, []rune{'z', unknown, 'z', 'y'}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			tty := &TTY{ctx: ctx, runes: make(chan readResult, readAhead)}
+			if tt.remap {
+				tty.Remap(Layouts["us"], Layouts["de"])
+			}
+
+			go func() {
+				for i, s := range tt.in {
+					if i > 0 {
+						time.Sleep(3 * EscapeTimeout)
+					}
+					for _, r := range s {
+						tty.runes <- readResult{r: r, at: time.Now()}
+					}
+				}
+				tty.runes <- readResult{err: io.EOF}
+			}()
+
+			var got []rune
+			for {
+				r, _, err := tty.ReadRune()
+				if err == io.EOF {
+					break
+				}
+				if err == ErrUnknownEscapeSequence {
+					r = unknown
+				} else if err != nil {
+					t.Fatalf("ReadRune error: %v", err)
+				}
+				got = append(got, r)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read %q, expected %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,10 +17,13 @@ func Open(ctx context.Context) (*TTY, error) {
 func (t *TTY) RestoreTermMode() {
 }
 
-func (t *TTY) Buffered() bool {
-	return false
+func (t *TTY) Remap(console, scanner Layout) {
 }
 
 func (t *TTY) ReadRune() (r rune, size int, err error) {
 	return ignoreKey, 1, errors.New("unimplemented")
 }
+
+func (t *TTY) Close() error {
+	return nil
+}
@@ -76,6 +76,11 @@ func (b *Binary) Cleanup() {
 	_ = os.Remove(b.signalFile())
 }
 
+// Version returns the hash of the running binary, it identifies the release
+func (b *Binary) Version() string {
+	return hex.EncodeToString(b.hash)
+}
+
 func (b *Binary) signalFile() string {
 	return filepath.Join(
 		file.TmpDir,
@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,7 +24,9 @@ type Account struct {
 	SSID, PW string
 }
 
-func StoreAndTry(ctx context.Context, cfg *config.Config, acc Account) error {
+// StoreAndTry saves the account and connects to it, progress is called before every step
+func StoreAndTry(ctx context.Context, cfg *config.Config, acc Account, progress func(step string)) error {
+	progress("Saving…")
 	if err := storeAccount(cfg, acc); err != nil {
 		return err
 	}
@@ -29,11 +34,13 @@ func StoreAndTry(ctx context.Context, cfg *config.Config, acc Account) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	if err := connect(ctx, acc); err != nil {
+	progress("Removing old…")
+	if err := deleteConnections(ctx); err != nil {
 		return err
 	}
 
-	return nil
+	progress("Connecting…")
+	return connectDevice(ctx, acc)
 }
 
 func accountPath(cfg *config.Config) string {
@@ -116,6 +123,10 @@ func connect(ctx context.Context, acc Account) error {
 		return err
 	}
 
+	return connectDevice(ctx, acc)
+}
+
+func connectDevice(ctx context.Context, acc Account) error {
 	// nmcli device wifi connect <SSID> password <PW>
 	cmd := exec.CommandContext(ctx, "nmcli", "device", "wifi", "connect", acc.SSID, "password", acc.PW)
 	out, err := cmd.CombinedOutput()
@@ -128,6 +139,43 @@ func connect(ctx context.Context, acc Account) error {
 	return nil
 }
 
+// Signal returns the link quality of the first wireless interface in percent
+func Signal() (int, error) {
+	// Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE
+	//  face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22
+	// wlan0: 0000   54.  -56.  -256        0      0      0      0      0        0
+	data, err := ioutil.ReadFile("/proc/net/wireless")
+	if err != nil {
+		return 0, err
+	}
+
+	// the interfaces start after the two header lines
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 3 {
+		return 0, errors.New("no wireless interface found")
+	}
+	for _, line := range lines[2:] {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+
+		link, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "."), 64)
+		if err != nil {
+			return 0, err
+		}
+
+		// the link quality is out of 70 for most drivers
+		perc := int(link * 100 / 70)
+		if perc > 100 {
+			perc = 100
+		}
+		return perc, nil
+	}
+
+	return 0, errors.New("no wireless interface found")
+}
+
 func IsConnected() bool {
 	_, err := http.Get("http://clients3.google.com/generate_204")
 	return err == nil
@@ -0,0 +1,21 @@
+-- upgrades a database created with the mysql.sql of before the operator, source, manual and undo
+-- columns and the curriers table, the barcode-scanner user cannot alter tables, run it as an admin
+-- BEFORE updating the devices, they cannot insert a single barcode into the old table
+--
+-- mysql -u root barcode-scanner < ref/migrations/001-barcode-columns-and-curriers.sql
+
+ALTER TABLE `barcodes`
+  ADD COLUMN `operator` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT 'badge ID of the logged in operator' AFTER `currier_service`,
+  ADD COLUMN `source` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT 'id of the scanner the barcode was read with' AFTER `operator`,
+  ADD COLUMN `manual` tinyint(1) NOT NULL DEFAULT 0 COMMENT 'typed by hand instead of scanned' AFTER `source`,
+  ADD COLUMN `undo` tinyint(1) NOT NULL DEFAULT 0 COMMENT 'cancels the previous row of the same barcode from the device' AFTER `manual`;
+
+CREATE TABLE IF NOT EXISTS `curriers` (
+  `id` int(10) unsigned NOT NULL COMMENT 'the number on the INGRESS-n/EGRESS-n barcodes',
+  `name` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'shown on the screen',
+  `pattern` text CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT 'optional regexp the barcodes of the currier match',
+  `active` tinyint(1) NOT NULL DEFAULT 1 COMMENT 'inactive curriers cannot be picked',
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+GRANT SELECT ON `barcode-scanner`.curriers TO 'barcode-scanner'@'%';
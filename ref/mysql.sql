@@ -15,6 +15,10 @@ CREATE TABLE `barcodes` (
   `barcode` text CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'the barcode',
   `direction` text CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'ingress/egress',
   `currier_service` text CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'ingress/egress postfix',
+  `operator` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT 'badge ID of the logged in operator',
+  `source` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT 'id of the scanner the barcode was read with',
+  `manual` tinyint(1) NOT NULL DEFAULT 0 COMMENT 'typed by hand instead of scanned',
+  `undo` tinyint(1) NOT NULL DEFAULT 0 COMMENT 'cancels the previous row of the same barcode from the device',
   `created_at` bigint(20) NOT NULL COMMENT 'timestamp of scanning (UTC, unix timestamp, usec accuracy)',
   `timestamp` timestamp NOT NULL ON UPDATE CURRENT_TIMESTAMP COMMENT 'timestamp of database entry (seconds accuracy)',
   PRIMARY KEY (`id`),
@@ -24,9 +28,22 @@ CREATE TABLE `barcodes` (
   CONSTRAINT `barcodes_ibfk_1` FOREIGN KEY (`deviceid`) REFERENCES `devices` (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+DROP TABLE IF EXISTS `curriers`;
+CREATE TABLE `curriers` (
+  `id` int(10) unsigned NOT NULL COMMENT 'the number on the INGRESS-n/EGRESS-n barcodes',
+  `name` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'shown on the screen',
+  `pattern` text CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT 'optional regexp the barcodes of the currier match',
+  `active` tinyint(1) NOT NULL DEFAULT 1 COMMENT 'inactive curriers cannot be picked',
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- existing databases are upgraded with the files in ref/migrations, in order
+
 -- barcode-scanner user must use ssl
 -- ALTER USER 'barcode-scanner'@'%' REQUIRE SSL;
 -- barcode-scanner user can only select/insert from the devices table:
 -- GRANT SELECT, INSERT ON `barcode-scanner`.devices TO 'barcode-scanner'@'%';
+-- can only select from the curriers table:
+-- GRANT SELECT ON `barcode-scanner`.curriers TO 'barcode-scanner'@'%';
 -- and can only insert into the barcodes table
 -- GRANT INSERT ON `barcode-scanner`.barcodes TO 'barcode-scanner'@'%';